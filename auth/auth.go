@@ -0,0 +1,366 @@
+// Package auth authenticates MCP requests with bearer tokens.
+//
+// An [Authenticator] is an [mcp.Interceptor] for servers. It reads the
+// bearer token from the request's metadata, such as the Authorization header
+// the sse transport copies there, checks it with a [Verifier] and puts the
+// resulting [Principal] in the handler's context. Incoming requests without
+// a valid token fail with [CodeUnauthorized]; requests the server sends to
+// the client are left alone.
+//
+// Tools, prompts and resources can require scopes. The Authenticator hides
+// the ones a principal lacks the scopes for from list results and rejects
+// requests for them, including resource subscriptions and completions, with
+// [CodeForbidden].
+//
+//	authn := auth.New(verifier,
+//		auth.WithToolScopes("delete_file", "files:write"),
+//		auth.WithResourceScopes("file:///{path}", "files:read"),
+//	)
+//	server := mcp.NewServer(stream, handler, mcp.WithInterceptors(authn))
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/riza-io/mcp-go"
+	"github.com/riza-io/mcp-go/uritemplate"
+)
+
+// Error codes of requests rejected by an [Authenticator].
+const (
+	// CodeUnauthorized rejects a request without a valid bearer token.
+	CodeUnauthorized = -32005
+
+	// CodeForbidden rejects a request for a tool, prompt or resource the
+	// principal doesn't have the scopes for.
+	CodeForbidden = -32006
+)
+
+var (
+	// ErrMissingToken is reported for requests without a bearer token.
+	ErrMissingToken = errors.New("missing bearer token")
+
+	// ErrInvalidToken can be returned by a [Verifier] for tokens it doesn't
+	// accept.
+	ErrInvalidToken = errors.New("invalid bearer token")
+)
+
+// A Principal is the caller a token was issued to.
+type Principal struct {
+	// Subject identifies the caller, such as a user or client ID.
+	Subject string
+	// Scopes are the scopes the token grants.
+	Scopes []string
+	// Claims holds any other information the verifier extracted from the
+	// token.
+	Claims map[string]any
+}
+
+// HasScopes reports whether p was granted every one of scopes.
+func (p *Principal) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(p.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx that carries p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request being handled in ctx.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// A Verifier checks a bearer token and returns the principal it was issued
+// to. It returns an error, such as [ErrInvalidToken], for tokens that are
+// malformed, expired or otherwise not accepted; an [*mcp.Error] is sent to
+// the client as is.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Principal, error)
+}
+
+// VerifierFunc adapts a function to a [Verifier].
+type VerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// StaticTokens returns a verifier that accepts the tokens in the map. It is
+// meant for development and tests.
+func StaticTokens(tokens map[string]*Principal) Verifier {
+	return VerifierFunc(func(ctx context.Context, token string) (*Principal, error) {
+		if p, ok := tokens[token]; ok {
+			return p, nil
+		}
+		return nil, ErrInvalidToken
+	})
+}
+
+// An Authenticator is an [mcp.Interceptor] that authenticates requests and
+// enforces scopes.
+//
+// Every incoming request needs a valid token except those for public
+// methods, which are authenticated only if they carry a token. Notifications
+// can't be rejected and are passed on unauthenticated, and requests the
+// server sends to the client, such as pings or calls made with [mcp.Call],
+// are passed on untouched.
+type Authenticator struct {
+	verifier Verifier
+	key      string
+	public   []mcp.Method
+
+	tools     map[string][]string
+	prompts   map[string][]string
+	resources []resourceRule
+}
+
+type resourceRule struct {
+	pattern  string
+	template *uritemplate.Template
+	scopes   []string
+}
+
+type Option interface {
+	apply(a *Authenticator)
+}
+
+type optionFunc func(a *Authenticator)
+
+func (f optionFunc) apply(a *Authenticator) {
+	f(a)
+}
+
+// WithMetadataKey reads the token from the metadata value key instead of
+// "Authorization". Keys are matched case-insensitively.
+func WithMetadataKey(key string) Option {
+	return optionFunc(func(a *Authenticator) {
+		a.key = key
+	})
+}
+
+// WithPublicMethods lets requests for methods through without a token, in
+// addition to ping.
+func WithPublicMethods(methods ...mcp.Method) Option {
+	return optionFunc(func(a *Authenticator) {
+		a.public = append(a.public, methods...)
+	})
+}
+
+// WithToolScopes requires every one of scopes to list or call the named
+// tool.
+func WithToolScopes(name string, scopes ...string) Option {
+	return optionFunc(func(a *Authenticator) {
+		a.tools[name] = append(a.tools[name], scopes...)
+	})
+}
+
+// WithPromptScopes requires every one of scopes to list or get the named
+// prompt.
+func WithPromptScopes(name string, scopes ...string) Option {
+	return optionFunc(func(a *Authenticator) {
+		a.prompts[name] = append(a.prompts[name], scopes...)
+	})
+}
+
+// WithResourceScopes requires every one of scopes to list or read the
+// resource with the given URI, or the resources matching the given URI
+// template. Reading a URI requires the scopes of every pattern it matches.
+// WithResourceScopes panics if pattern isn't a valid URI template.
+func WithResourceScopes(pattern string, scopes ...string) Option {
+	t, err := uritemplate.Parse(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("auth: resource scopes for %s: %v", pattern, err))
+	}
+	return optionFunc(func(a *Authenticator) {
+		a.resources = append(a.resources, resourceRule{pattern, t, scopes})
+	})
+}
+
+// New returns an Authenticator that checks tokens with v. Without options it
+// reads the token from the Authorization metadata value, lets ping through
+// without one and requires no scopes.
+func New(v Verifier, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		verifier: v,
+		key:      "Authorization",
+		public:   []mcp.Method{mcp.MethodPing},
+		tools:    map[string][]string{},
+		prompts:  map[string][]string{},
+	}
+	for _, opt := range opts {
+		opt.apply(a)
+	}
+	return a
+}
+
+func (a *Authenticator) WrapUnary(next mcp.UnaryFunc) mcp.UnaryFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) (mcp.AnyResponse, error) {
+		if req.ID() == "" || req.Outgoing() {
+			return next(ctx, req)
+		}
+		p, err := a.authenticate(ctx, req)
+		if err != nil {
+			if slices.Contains(a.public, mcp.Method(req.Method())) && errors.Is(err, ErrMissingToken) {
+				return next(ctx, req)
+			}
+			return nil, err
+		}
+		ctx = NewContext(ctx, p)
+		if err := a.authorize(p, req); err != nil {
+			return nil, err
+		}
+		resp, err := next(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return a.filter(p, resp), nil
+	}
+}
+
+// authenticate verifies the bearer token of req.
+func (a *Authenticator) authenticate(ctx context.Context, req mcp.AnyRequest) (*Principal, error) {
+	token, ok := bearerToken(a.lookup(req.Metadata()))
+	if !ok {
+		return nil, mcp.NewError(CodeUnauthorized, ErrMissingToken)
+	}
+	p, err := a.verifier.Verify(ctx, token)
+	if err != nil {
+		var rpcErr *mcp.Error
+		if errors.As(err, &rpcErr) {
+			return nil, err
+		}
+		return nil, mcp.NewError(CodeUnauthorized, err)
+	}
+	if p == nil {
+		return nil, mcp.NewError(CodeUnauthorized, ErrInvalidToken)
+	}
+	return p, nil
+}
+
+func (a *Authenticator) lookup(metadata map[string]string) string {
+	if v, ok := metadata[a.key]; ok {
+		return v
+	}
+	for k, v := range metadata {
+		if strings.EqualFold(k, a.key) {
+			return v
+		}
+	}
+	return ""
+}
+
+// bearerToken returns the token of an Authorization value using the Bearer
+// scheme.
+func bearerToken(value string) (string, bool) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authorize checks that p has the scopes for the tool, prompt or resource
+// req is for.
+func (a *Authenticator) authorize(p *Principal, req mcp.AnyRequest) error {
+	switch params := req.Any().(type) {
+	case *mcp.CallToolRequest:
+		if !p.HasScopes(a.tools[params.Name]...) {
+			return forbidden("tool", params.Name, a.tools[params.Name])
+		}
+	case *mcp.GetPromptRequest:
+		if !p.HasScopes(a.prompts[params.Name]...) {
+			return forbidden("prompt", params.Name, a.prompts[params.Name])
+		}
+	case *mcp.ReadResourceRequest:
+		if scopes := a.resourceScopes(params.URI); !p.HasScopes(scopes...) {
+			return forbidden("resource", params.URI, scopes)
+		}
+	case *mcp.SubscribeRequest:
+		if scopes := a.resourceScopes(params.URI); !p.HasScopes(scopes...) {
+			return forbidden("resource", params.URI, scopes)
+		}
+	case *mcp.CompletionRequest:
+		switch params.Ref.Type {
+		case "ref/prompt":
+			if !p.HasScopes(a.prompts[params.Ref.Name]...) {
+				return forbidden("prompt", params.Ref.Name, a.prompts[params.Ref.Name])
+			}
+		case "ref/resource":
+			if scopes := a.templateScopes(params.Ref.URI); !p.HasScopes(scopes...) {
+				return forbidden("resource template", params.Ref.URI, scopes)
+			}
+		}
+	}
+	return nil
+}
+
+func forbidden(kind, name string, scopes []string) error {
+	return mcp.NewError(CodeForbidden, fmt.Errorf("%s %s requires scopes %s", kind, name, strings.Join(scopes, ", ")))
+}
+
+// resourceScopes returns the scopes needed to read uri.
+func (a *Authenticator) resourceScopes(uri string) []string {
+	var scopes []string
+	for _, r := range a.resources {
+		if _, ok := r.template.Match(uri); ok {
+			scopes = append(scopes, r.scopes...)
+		}
+	}
+	return scopes
+}
+
+// templateScopes returns the scopes needed to list a resource template.
+func (a *Authenticator) templateScopes(template string) []string {
+	var scopes []string
+	for _, r := range a.resources {
+		if r.pattern == template {
+			scopes = append(scopes, r.scopes...)
+		}
+	}
+	return scopes
+}
+
+// filter removes the items p lacks the scopes for from list results.
+func (a *Authenticator) filter(p *Principal, resp mcp.AnyResponse) mcp.AnyResponse {
+	switch result := resp.Any().(type) {
+	case *mcp.ListToolsResponse:
+		filtered := *result
+		filtered.Tools = slices.DeleteFunc(slices.Clone(result.Tools), func(t mcp.Tool) bool {
+			return !p.HasScopes(a.tools[t.Name]...)
+		})
+		return mcp.NewResponse(&filtered)
+	case *mcp.ListPromptsResponse:
+		filtered := *result
+		filtered.Prompts = slices.DeleteFunc(slices.Clone(result.Prompts), func(pr mcp.Prompt) bool {
+			return !p.HasScopes(a.prompts[pr.Name]...)
+		})
+		return mcp.NewResponse(&filtered)
+	case *mcp.ListResourcesResponse:
+		filtered := *result
+		filtered.Resources = slices.DeleteFunc(slices.Clone(result.Resources), func(r mcp.Resource) bool {
+			return !p.HasScopes(a.resourceScopes(r.URI)...)
+		})
+		return mcp.NewResponse(&filtered)
+	case *mcp.ListResourceTemplatesResponse:
+		filtered := *result
+		filtered.Templates = slices.DeleteFunc(slices.Clone(result.Templates), func(t mcp.ResourceTemplate) bool {
+			return !p.HasScopes(a.templateScopes(t.URITemplate)...)
+		})
+		return mcp.NewResponse(&filtered)
+	}
+	return resp
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/riza-io/mcp-go"
+)
+
+func TestBearerToken(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		token string
+		ok    bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"bearer  abc ", "abc", true},
+		{"Basic abc", "", false},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"", "", false},
+	} {
+		token, ok := bearerToken(tt.value)
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("bearerToken(%q) = %q, %v; want %q, %v", tt.value, token, ok, tt.token, tt.ok)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	a := New(StaticTokens(nil),
+		WithToolScopes("delete", "write"),
+		WithResourceScopes("file:///{+path}", "read"),
+		WithResourceScopes("file:///secret", "admin"),
+		WithResourceScopes("db://{table}", "admin"),
+		WithPromptScopes("review", "write"),
+	)
+	p := &Principal{Subject: "alice", Scopes: []string{"read"}}
+
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CallToolRequest{Name: "add"})); err != nil {
+		t.Errorf("unscoped tool: %v", err)
+	}
+	var rpcErr *mcp.Error
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CallToolRequest{Name: "delete"})); !errors.As(err, &rpcErr) || rpcErr.Code() != CodeForbidden {
+		t.Errorf("scoped tool: got %v, want code %d", err, CodeForbidden)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.ReadResourceRequest{URI: "file:///notes.txt"})); err != nil {
+		t.Errorf("readable resource: %v", err)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.ReadResourceRequest{URI: "file:///secret"})); !errors.As(err, &rpcErr) || rpcErr.Code() != CodeForbidden {
+		t.Errorf("secret resource: got %v, want code %d", err, CodeForbidden)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.SubscribeRequest{URI: "file:///notes.txt"})); err != nil {
+		t.Errorf("subscribe to readable resource: %v", err)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.SubscribeRequest{URI: "file:///secret"})); !errors.As(err, &rpcErr) || rpcErr.Code() != CodeForbidden {
+		t.Errorf("subscribe to secret resource: got %v, want code %d", err, CodeForbidden)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CompletionRequest{Ref: mcp.CompletionRef{Type: "ref/prompt", Name: "greet"}})); err != nil {
+		t.Errorf("complete unscoped prompt: %v", err)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CompletionRequest{Ref: mcp.CompletionRef{Type: "ref/prompt", Name: "review"}})); !errors.As(err, &rpcErr) || rpcErr.Code() != CodeForbidden {
+		t.Errorf("complete scoped prompt: got %v, want code %d", err, CodeForbidden)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CompletionRequest{Ref: mcp.CompletionRef{Type: "ref/resource", URI: "file:///{+path}"}})); err != nil {
+		t.Errorf("complete readable template: %v", err)
+	}
+	if err := a.authorize(p, mcp.NewRequest(&mcp.CompletionRequest{Ref: mcp.CompletionRef{Type: "ref/resource", URI: "db://{table}"}})); !errors.As(err, &rpcErr) || rpcErr.Code() != CodeForbidden {
+		t.Errorf("complete scoped template: got %v, want code %d", err, CodeForbidden)
+	}
+
+	resp := a.filter(p, mcp.NewResponse(&mcp.ListToolsResponse{
+		Tools: []mcp.Tool{{Name: "add"}, {Name: "delete"}},
+	}))
+	tools := resp.Any().(*mcp.ListToolsResponse).Tools
+	if len(tools) != 1 || tools[0].Name != "add" {
+		t.Errorf("filtered tools = %v, want [add]", tools)
+	}
+}
+
+func TestStaticTokens(t *testing.T) {
+	ctx := context.Background()
+	alice := &Principal{Subject: "alice"}
+	v := StaticTokens(map[string]*Principal{"secret": alice})
+
+	if p, err := v.Verify(ctx, "secret"); err != nil || p != alice {
+		t.Errorf("Verify(secret) = %v, %v; want alice", p, err)
+	}
+	if _, err := v.Verify(ctx, "guess"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify(guess) error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -2,6 +2,8 @@ package mcp
 
 import (
 	"context"
+	"errors"
+	"io"
 	"strconv"
 )
 
@@ -9,29 +11,181 @@ type base struct {
 	router       *router
 	stream       Stream
 	interceptors []Interceptor
+
+	// routerFor, if set, picks the router for an incoming response instead
+	// of router. Servers use it to keep one id space per session.
+	routerFor func(msg *Message) *router
+
+	// sessions, if set, reports the sessions a SessionStream opens and
+	// closes. listen handles them in order with the stream's messages, so
+	// a session is open before its first message is handled.
+	sessions *sessionEvents
+
+	// bind, if set, prepares the context an incoming request or
+	// notification is handled with. listen calls it in order with session
+	// events, so a message is bound to its session even if the session
+	// closes before the message is handled.
+	bind func(ctx context.Context, msg *Message) context.Context
+
+	// limiter, if set, bounds how many incoming messages are handled at once.
+	limiter *limiter
+
+	// sequencer, if set, orders the handling of incoming messages.
+	sequencer *sequencer
+
+	// callTimeouts bound outgoing requests and handlerTimeouts the handling
+	// of incoming ones.
+	callTimeouts    timeouts
+	handlerTimeouts timeouts
+
+	handlers handlers
+
+	// onPanic reports panics recovered while handling messages.
+	onPanic PanicHandler
+
+	lifecycle lifecycle
 }
 
-func (b *base) listen(ctx context.Context, handler func(ctx context.Context, msg *Message) error) error {
+// listen handles incoming messages until ctx ends, the stream fails or the
+// connection is shut down. It returns nil when the stream ends with io.EOF
+// or once a shutdown has finished. Pending and later calls on b fail once it
+// returns.
+func (b *base) listen(ctx context.Context, handler func(ctx context.Context, msg *Message) error) (err error) {
+	defer func() {
+		b.router.close(err)
+	}()
+	msgs := make(chan *Message)
+	errc := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			msg, err := b.stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var opened, closed <-chan string
+	if b.sessions != nil {
+		opened, closed = b.sessions.stream.OpenedSessions(), b.sessions.stream.ClosedSessions()
+	}
+
 	for {
-		msg, err := b.stream.Recv()
-		if err != nil {
-			return err
+		var msg *Message
+		select {
+		case id := <-opened:
+			b.sessions.open(ctx, id)
+			continue
+		case id := <-closed:
+			b.sessions.close(ctx, id)
+			continue
+		case msg = <-msgs:
+		case err := <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			select {
+			case <-b.lifecycle.closingChan():
+				return nil
+			default:
+				return err
+			}
+		case <-b.lifecycle.doneChan():
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 		if msg == nil {
 			continue
 		}
 		if msg.Method != nil {
-			go func() {
-				handler(ctx, msg)
-			}()
+			if Method(*msg.Method) == MethodCancelled {
+				b.handlers.cancel(msg)
+			}
+			if !b.lifecycle.begin() {
+				if msg.ID != nil {
+					b.stream.Send(&Message{
+						Metadata: msg.Metadata,
+						ID:       msg.ID,
+						JsonRPC:  msg.JsonRPC,
+						Error:    errorDetail(NewError(CodeConnectionClosed, errors.New("connection is shutting down"))),
+					})
+				}
+				continue
+			}
+			hctx, done := ctx, b.lifecycle.end
+			if b.bind != nil {
+				hctx = b.bind(hctx, msg)
+			}
+			if msg.ID != nil {
+				var finish func()
+				hctx, finish = b.handlers.start(hctx, msg)
+				done = func() {
+					finish()
+					b.lifecycle.end()
+				}
+			}
+			session := msg.Metadata["session_id"]
+			run, drop := b.sequencer.wrap(session, msg.ID == nil, func() {
+				defer done()
+				hctx, cancel := b.handlerTimeouts.withTimeout(hctx, Method(*msg.Method))
+				defer cancel()
+				defer b.recoverHandler(hctx, msg)
+				handler(hctx, msg)
+			})
+			if b.limiter == nil {
+				go run()
+				continue
+			}
+			if !b.limiter.submit(ctx, session, msg.ID != nil, run) {
+				drop()
+				done()
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				b.stream.Send(&Message{
+					Metadata: msg.Metadata,
+					ID:       msg.ID,
+					JsonRPC:  msg.JsonRPC,
+					Error:    errorDetail(NewError(CodeOverloaded, errors.New("server overloaded"))),
+				})
+			}
 		} else {
 			id, err := strconv.ParseUint(msg.ID.String(), 10, 64)
 			if err != nil {
 				continue
 			}
-			if inbox, ok := b.router.Remove(id); ok {
+			r := b.router
+			if b.routerFor != nil {
+				r = b.routerFor(msg)
+			}
+			if r == nil {
+				continue
+			}
+			if inbox, ok := r.Remove(id); ok {
 				inbox <- msg
 			}
 		}
 	}
 }
+
+// reply sends msg, the response to a request handled with ctx. Responses to
+// requests the peer cancelled are dropped, and errors from handlers that ran
+// out of time are reported with [CodeRequestTimeout].
+func (b *base) reply(ctx context.Context, method string, msg *Message) error {
+	if errors.Is(context.Cause(ctx), errCancelledByPeer) {
+		return nil
+	}
+	if msg.Error != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		msg.Error = errorDetail(timeoutError(method, ctx.Err()))
+	}
+	return b.stream.Send(msg)
+}
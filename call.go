@@ -8,8 +8,48 @@ import (
 	"strconv"
 )
 
+// A Peer is an end of a connection that can send messages: a [*Client], a
+// [*Server] or one of a server's [*Session] values.
+type Peer interface {
+	peers(ctx context.Context) ([]*base, error)
+}
+
+// Call sends a request for method to the other end of the connection and
+// waits for its response. It is meant for methods the SDK has no typed
+// wrapper for, such as vendor extensions; the peer's interceptors apply as
+// they do to every other call.
+//
+// A server sends the request to the session of the request being handled in
+// ctx or, outside a handler, to its only session. Use a [*Session] as the
+// peer to choose one when several clients are connected.
+func Call[P, R any](ctx context.Context, p Peer, method Method, req *Request[P]) (*Response[R], error) {
+	b, err := single(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return call[P, R](ctx, b, string(method), req)
+}
+
+// single returns the one connection a request from p should go to.
+func single(ctx context.Context, p Peer) (*base, error) {
+	bs, err := p.peers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) != 1 {
+		return nil, fmt.Errorf("request must target one session, not %d", len(bs))
+	}
+	return bs[0], nil
+}
+
 func call[P any, R any](ctx context.Context, c *base, method string, req *Request[P]) (*Response[R], error) {
-	id, inbox := c.router.Add()
+	ctx, cancel := c.callTimeouts.withTimeout(ctx, Method(method))
+	defer cancel()
+
+	id, inbox, err := c.router.Add()
+	if err != nil {
+		return nil, err
+	}
 
 	var interceptor Interceptor
 	if len(c.interceptors) > 0 {
@@ -48,9 +88,16 @@ func call[P any, R any](ctx context.Context, c *base, method string, req *Reques
 		var result R
 
 		select {
-		case resp := <-inbox:
+		case resp, ok := <-inbox:
+			if !ok {
+				return nil, c.router.failed()
+			}
 			if resp.Error != nil {
-				return nil, NewError(resp.Error.Code, errors.New(resp.Error.Message))
+				rpcErr := NewError(resp.Error.Code, errors.New(resp.Error.Message))
+				if len(resp.Error.Data) > 0 && string(resp.Error.Data) != "null" {
+					rpcErr.data = resp.Error.Data
+				}
+				return nil, rpcErr
 			}
 			if resp.Result == nil {
 				return nil, fmt.Errorf("no result")
@@ -59,7 +106,12 @@ func call[P any, R any](ctx context.Context, c *base, method string, req *Reques
 				return nil, err
 			}
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			c.router.Remove(id)
+			notify(context.WithoutCancel(ctx), c, string(MethodCancelled), NewRequest(&CancelledNotification{
+				RequestID: msgID,
+				Reason:    ctx.Err().Error(),
+			}))
+			return nil, timeoutError(method, ctx.Err())
 		}
 
 		return NewResponse(&result), nil
@@ -67,6 +119,7 @@ func call[P any, R any](ctx context.Context, c *base, method string, req *Reques
 
 	req.id = strconv.FormatUint(id, 10)
 	req.method = method
+	req.outgoing = true
 
 	resp, err := interceptor.WrapUnary(inner)(ctx, req)
 	if err != nil {
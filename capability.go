@@ -0,0 +1,130 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// ErrUnimplemented is returned by the methods of [UnimplementedServer] and
+// by a [Mux] for methods without a handler.
+var ErrUnimplemented = errors.New("unimplemented")
+
+// CapabilityError is returned by [Client] methods when the server did not
+// advertise the capability the method requires. The request is never sent.
+type CapabilityError struct {
+	Method     Method
+	Capability string
+}
+
+func (e *CapabilityError) Error() string {
+	return fmt.Sprintf("server does not support the %s capability required by %s", e.Capability, e.Method)
+}
+
+// requiredCapability returns the name of the server capability a method
+// depends on, or the empty string if the method is always available.
+//
+// logging/setLevel is deliberately not gated: many servers accept the request
+// without advertising the logging capability.
+func requiredCapability(m Method) string {
+	switch m {
+	case MethodListTools, MethodCallTool:
+		return "tools"
+	case MethodListPrompts, MethodGetPrompt:
+		return "prompts"
+	case MethodListResources, MethodReadResource, MethodListResourceTemplates:
+		return "resources"
+	case MethodSubscribe, MethodUnsubscribe:
+		return "resources.subscribe"
+	default:
+		return ""
+	}
+}
+
+// Supports reports whether the capabilities include the feature the given
+// method depends on.
+func (c *ServerCapabilities) Supports(m Method) bool {
+	switch requiredCapability(m) {
+	case "tools":
+		return c.Tools != nil
+	case "prompts":
+		return c.Prompts != nil
+	case "resources":
+		return c.Resources != nil
+	case "resources.subscribe":
+		return c.Resources != nil && c.Resources.Subscribe
+	default:
+		return true
+	}
+}
+
+// merge fills every capability that is unset in c from other.
+func (c *ServerCapabilities) merge(other ServerCapabilities) {
+	if c.Logging == nil {
+		c.Logging = other.Logging
+	}
+	if c.Tools == nil {
+		c.Tools = other.Tools
+	}
+	if c.Resources == nil {
+		c.Resources = other.Resources
+	}
+	if c.Prompts == nil {
+		c.Prompts = other.Prompts
+	}
+	c.Experimental = mergeExperimental(c.Experimental, other.Experimental)
+}
+
+// mergeExperimental returns a copy of caps with every capability from other
+// that caps doesn't already have.
+func mergeExperimental(caps, other map[string]json.RawMessage) map[string]json.RawMessage {
+	if len(other) == 0 {
+		return caps
+	}
+	merged := maps.Clone(caps)
+	if merged == nil {
+		merged = map[string]json.RawMessage{}
+	}
+	for name, settings := range other {
+		if _, ok := merged[name]; !ok {
+			merged[name] = settings
+		}
+	}
+	return merged
+}
+
+// deriveCapabilities works out which features the server provides without
+// calling the handler. Capabilities given with [WithCapabilities] take
+// precedence, and features backed by a registry are always advertised. A
+// [Mux] provides the features it has list handlers for, and a handler that
+// implements [ServerHandler] itself provides all of them, logging included.
+// Methods of a handler that embeds [UnimplementedServer] can't be told apart
+// from the ones it overrides, so such handlers advertise their features with
+// WithCapabilities or a registry.
+func (s *Server) deriveCapabilities() ServerCapabilities {
+	h := s.mux
+	caps := ServerCapabilities{
+		Experimental: s.experimental,
+	}
+	if h.provides(MethodSetLogLevel) {
+		caps.Logging = &Logging{}
+	}
+	// Registries announce their changes, so servers using them support
+	// listChanged.
+	if s.tools != nil || h.provides(MethodListTools) {
+		caps.Tools = &Tools{ListChanged: s.tools != nil}
+	}
+	if s.prompts != nil || h.provides(MethodListPrompts) {
+		caps.Prompts = &Prompts{ListChanged: s.prompts != nil}
+	}
+	if s.resources != nil || h.provides(MethodListResources) || h.provides(MethodListResourceTemplates) {
+		caps.Resources = &Resources{
+			Subscribe:   h.provides(MethodSubscribe),
+			ListChanged: s.resources != nil,
+		}
+	}
+	explicit := s.capabilities
+	explicit.merge(caps)
+	return explicit
+}
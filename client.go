@@ -2,7 +2,11 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sync"
+
+	"github.com/riza-io/mcp-go/jsonschema"
 )
 
 type ClientHandler interface {
@@ -28,11 +32,23 @@ type Client struct {
 	handler      ClientHandler
 	interceptors []Interceptor
 	base         *base
+	mux          *Mux
+	experimental map[string]json.RawMessage
+
+	validateToolOutput bool
+	ordering           ordering
+	callTimeouts       timeouts
+	onPanic            PanicHandler
+
+	mu            sync.Mutex
+	serverCaps    *ServerCapabilities
+	outputSchemas map[string]*jsonschema.Schema
 }
 
-func NewClient(stream Stream, handler ClientHandler, opts ...Option) *Client {
+func NewClient(stream Stream, handler ClientHandler, opts ...ClientOption) *Client {
 	c := &Client{
 		handler: handler,
+		mux:     NewMux(),
 	}
 	for _, opt := range opts {
 		opt.applyToClient(c)
@@ -41,6 +57,9 @@ func NewClient(stream Stream, handler ClientHandler, opts ...Option) *Client {
 		router:       newRouter(),
 		interceptors: c.interceptors,
 		stream:       stream,
+		sequencer:    newSequencer(c.ordering),
+		callTimeouts: c.callTimeouts,
+		onPanic:      c.onPanic,
 	}
 	return c
 }
@@ -50,6 +69,14 @@ func (c *Client) Listen(ctx context.Context) error {
 	return c.base.listen(ctx, c.processMessage)
 }
 
+// Err returns nil while the client is listening or before it starts, and
+// the reason it stopped afterwards: the error [Client.Listen] returned, or
+// [ErrConnectionClosed] if it stopped cleanly. Calls fail once the client
+// has stopped.
+func (c *Client) Err() error {
+	return c.base.router.Err()
+}
+
 func (c *Client) processMessage(ctx context.Context, msg *Message) error {
 	rr, err := c.ServeMCP(ctx, msg)
 	if err != nil {
@@ -58,7 +85,7 @@ func (c *Client) processMessage(ctx context.Context, msg *Message) error {
 	if rr == nil {
 		return nil
 	}
-	return c.base.stream.Send(rr)
+	return c.base.reply(ctx, *msg.Method, rr)
 }
 
 func (c *Client) ServeMCP(ctx context.Context, msg *Message) (*Message, error) {
@@ -69,44 +96,163 @@ func (c *Client) ServeMCP(ctx context.Context, msg *Message) (*Message, error) {
 	case MethodNotificationsMessage:
 		return serveMCP(ctx, c.base, msg, noop(h.LogMessage))
 	default:
-		return nil, fmt.Errorf("unknown method: %s", m)
+		return c.mux.serve(ctx, c.base, msg)
 	}
 }
 
+func (c *Client) peers(ctx context.Context) ([]*base, error) {
+	return []*base{c.base}, nil
+}
+
+func (c *Client) register(method Method, e *muxEntry) {
+	c.mux.register(method, e)
+}
+
 func (c *Client) Initialize(ctx context.Context, request *Request[InitializeRequest]) (*Response[InitializeResponse], error) {
-	return call[InitializeRequest, InitializeResponse](ctx, c.base, "initialize", request)
+	if len(c.experimental) > 0 {
+		params := *request.Params
+		params.Capabilities.Experimental = mergeExperimental(params.Capabilities.Experimental, c.experimental)
+		req := *request
+		req.Params = &params
+		request = &req
+	}
+	resp, err := call[InitializeRequest, InitializeResponse](ctx, c.base, "initialize", request)
+	if err != nil {
+		return nil, err
+	}
+	caps := resp.Result.Capabilities
+	c.mu.Lock()
+	c.serverCaps = &caps
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// ServerCapabilities returns the capabilities the server advertised in its
+// initialize response, or nil if the client has not initialized yet.
+func (c *Client) ServerCapabilities() *ServerCapabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.serverCaps
+}
+
+// checkCapability returns a [*CapabilityError] if the server is known not to
+// support the given method. Before initialization every method is allowed.
+func (c *Client) checkCapability(m Method) error {
+	caps := c.ServerCapabilities()
+	if caps == nil || caps.Supports(m) {
+		return nil
+	}
+	return &CapabilityError{Method: m, Capability: requiredCapability(m)}
 }
 
 func (c *Client) ListResources(ctx context.Context, request *Request[ListResourcesRequest]) (*Response[ListResourcesResponse], error) {
+	if err := c.checkCapability(MethodListResources); err != nil {
+		return nil, err
+	}
 	return call[ListResourcesRequest, ListResourcesResponse](ctx, c.base, "resources/list", request)
 }
 
+func (c *Client) Subscribe(ctx context.Context, request *Request[SubscribeRequest]) (*Response[SubscribeResponse], error) {
+	if err := c.checkCapability(MethodSubscribe); err != nil {
+		return nil, err
+	}
+	return call[SubscribeRequest, SubscribeResponse](ctx, c.base, string(MethodSubscribe), request)
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, request *Request[UnsubscribeRequest]) (*Response[UnsubscribeResponse], error) {
+	if err := c.checkCapability(MethodUnsubscribe); err != nil {
+		return nil, err
+	}
+	return call[UnsubscribeRequest, UnsubscribeResponse](ctx, c.base, string(MethodUnsubscribe), request)
+}
+
 func (c *Client) ListTools(ctx context.Context, request *Request[ListToolsRequest]) (*Response[ListToolsResponse], error) {
-	return call[ListToolsRequest, ListToolsResponse](ctx, c.base, "tools/list", request)
+	if err := c.checkCapability(MethodListTools); err != nil {
+		return nil, err
+	}
+	resp, err := call[ListToolsRequest, ListToolsResponse](ctx, c.base, "tools/list", request)
+	if err != nil {
+		return nil, err
+	}
+	if c.validateToolOutput {
+		c.storeOutputSchemas(request.Params.Cursor == "", resp.Result.Tools)
+	}
+	return resp, nil
+}
+
+// storeOutputSchemas remembers the output schemas of listed tools. The first
+// page of a listing replaces whatever was stored before.
+func (c *Client) storeOutputSchemas(reset bool, tools []Tool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if reset || c.outputSchemas == nil {
+		c.outputSchemas = map[string]*jsonschema.Schema{}
+	}
+	for _, t := range tools {
+		if len(t.OutputSchema) == 0 {
+			delete(c.outputSchemas, t.Name)
+			continue
+		}
+		schema := new(jsonschema.Schema)
+		if err := json.Unmarshal(t.OutputSchema, schema); err != nil {
+			delete(c.outputSchemas, t.Name)
+			continue
+		}
+		c.outputSchemas[t.Name] = schema
+	}
 }
 
 func (c *Client) CallTool(ctx context.Context, request *Request[CallToolRequest]) (*Response[CallToolResponse], error) {
-	return call[CallToolRequest, CallToolResponse](ctx, c.base, "tools/call", request)
+	if err := c.checkCapability(MethodCallTool); err != nil {
+		return nil, err
+	}
+	resp, err := call[CallToolRequest, CallToolResponse](ctx, c.base, "tools/call", request)
+	if err != nil {
+		return nil, err
+	}
+	if c.validateToolOutput && !resp.Result.IsError {
+		c.mu.Lock()
+		schema := c.outputSchemas[request.Params.Name]
+		c.mu.Unlock()
+		if schema != nil {
+			if err := validateStructuredContent(schema, resp.Result); err != nil {
+				return nil, &ToolOutputError{Tool: request.Params.Name, Err: err}
+			}
+		}
+	}
+	return resp, nil
 }
 
 func (c *Client) ListPrompts(ctx context.Context, request *Request[ListPromptsRequest]) (*Response[ListPromptsResponse], error) {
+	if err := c.checkCapability(MethodListPrompts); err != nil {
+		return nil, err
+	}
 	return call[ListPromptsRequest, ListPromptsResponse](ctx, c.base, "prompts/list", request)
 }
 
 func (c *Client) GetPrompt(ctx context.Context, request *Request[GetPromptRequest]) (*Response[GetPromptResponse], error) {
+	if err := c.checkCapability(MethodGetPrompt); err != nil {
+		return nil, err
+	}
 	return call[GetPromptRequest, GetPromptResponse](ctx, c.base, "prompts/get", request)
 }
 
 func (c *Client) ReadResource(ctx context.Context, request *Request[ReadResourceRequest]) (*Response[ReadResourceResponse], error) {
+	if err := c.checkCapability(MethodReadResource); err != nil {
+		return nil, err
+	}
 	return call[ReadResourceRequest, ReadResourceResponse](ctx, c.base, "resources/read", request)
 }
 
 func (c *Client) ListResourceTemplates(ctx context.Context, request *Request[ListResourceTemplatesRequest]) (*Response[ListResourceTemplatesResponse], error) {
+	if err := c.checkCapability(MethodListResourceTemplates); err != nil {
+		return nil, err
+	}
 	return call[ListResourceTemplatesRequest, ListResourceTemplatesResponse](ctx, c.base, "resources/templates/list", request)
 }
 
 func (c *Client) Completion(ctx context.Context, request *Request[CompletionRequest]) (*Response[CompletionResponse], error) {
-	return call[CompletionRequest, CompletionResponse](ctx, c.base, "completion", request)
+	return call[CompletionRequest, CompletionResponse](ctx, c.base, "completion/complete", request)
 }
 
 func (c *Client) Ping(ctx context.Context, request *Request[PingRequest]) (*Response[PingResponse], error) {
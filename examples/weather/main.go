@@ -18,10 +18,6 @@ func (s *WeatherServer) Initialize(ctx context.Context, req *mcp.Request[mcp.Ini
 	fmt.Println("Initialize", req.Params.ProtocolVersion)
 	return mcp.NewResponse(&mcp.InitializeResponse{
 		ProtocolVersion: req.Params.ProtocolVersion,
-		Capabilities: mcp.ServerCapabilities{
-			Resources: &mcp.Resources{},
-			Tools:     &mcp.Tools{},
-		},
 	}), nil
 }
 
@@ -30,7 +26,8 @@ func main() {
 
 	mux := http.NewServeMux()
 
-	server := mcp.NewServer(sse.NewStream(mux, "/sse", "/messages"), &WeatherServer{})
+	server := mcp.NewServer(sse.NewStream(mux, "/sse", "/messages"), &WeatherServer{},
+		mcp.WithToolRegistry(tools()))
 
 	go func() {
 		if err := http.ListenAndServe(":3009", mux); err != nil {
@@ -2,47 +2,16 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/riza-io/mcp-go"
 )
 
-const getForecastSchema = `{
-  "type": "object",
-  "properties": {
-    "latitude": {
-      "type": "number"
-    },
-    "longitude": {
-      "type": "number"
-    }
-  },
-  "required": ["latitude", "longitude"]
-}`
-
 type GetForecastArguments struct {
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
-}
-
-func (s *WeatherServer) ListTools(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
-	return mcp.NewResponse(&mcp.ListToolsResponse{
-		Tools: []mcp.Tool{
-			{
-				Name:        "get_forecast",
-				Description: "Get weather forecast for a location.",
-				InputSchema: json.RawMessage([]byte(getForecastSchema)),
-			},
-		},
-	}), nil
+	Latitude  float64 `json:"latitude" description:"Latitude of the location"`
+	Longitude float64 `json:"longitude" description:"Longitude of the location"`
 }
 
-func (s *WeatherServer) CallTool(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
-	var args GetForecastArguments
-	if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
-		return nil, err
-	}
-
+func getForecast(ctx context.Context, args GetForecastArguments) ([]mcp.Content, error) {
 	points, err := fetchPoints(args.Latitude, args.Longitude)
 	if err != nil {
 		return nil, err
@@ -60,8 +29,14 @@ func (s *WeatherServer) CallTool(ctx context.Context, req *mcp.Request[mcp.CallT
 			Text: period.DetailedForecast,
 		})
 	}
+	return content, nil
+}
 
-	return mcp.NewResponse(&mcp.CallToolResponse{
-		Content: content,
-	}), nil
+func tools() *mcp.ToolRegistry {
+	r := mcp.NewToolRegistry()
+	mcp.AddTool(r, mcp.Tool{
+		Name:        "get_forecast",
+		Description: "Get weather forecast for a location.",
+	}, getForecast)
+	return r
 }
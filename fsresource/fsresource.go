@@ -0,0 +1,451 @@
+// Package fsresource exposes the files of an [fs.FS] as MCP resources.
+//
+// A [Provider] lists files with pagination, reads them as text or base64 blobs
+// depending on their content type, and serves a resource template that
+// addresses any file or directory under the root. Files can be filtered with
+// include and exclude globs and a maximum size. [Provider.Watch] polls the
+// file system and notifies the client when files are added, removed or
+// changed.
+//
+//	p := fsresource.New(os.DirFS(root), fsresource.WithExclude(".git"))
+//	mux := mcp.NewMux()
+//	p.Register(mux)
+//	server := mcp.NewServer(stream, mux,
+//		mcp.WithCapabilities(mcp.ServerCapabilities{Resources: p.Capabilities()}),
+//		mcp.OnSessionEnd(p.EndSession),
+//	)
+//	go p.Watch(ctx, server, 2*time.Second)
+package fsresource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/riza-io/mcp-go"
+	"github.com/riza-io/mcp-go/uritemplate"
+)
+
+// DefaultPageSize is the number of resources returned per resources/list page
+// unless [WithPageSize] says otherwise.
+const DefaultPageSize = 100
+
+// A Provider serves the files of an [fs.FS] as resources. Register its
+// handlers with [Provider.Register].
+type Provider struct {
+	fsys     fs.FS
+	baseURI  string
+	include  []string
+	exclude  []string
+	maxSize  int64
+	pageSize int
+	template *uritemplate.Template
+
+	mu    sync.Mutex
+	subs  map[*mcp.Session]map[string]bool
+	files map[string]fileState // set once Watch has scanned the file system
+	names []string             // keys of files in walk order
+}
+
+type Option interface {
+	apply(p *Provider)
+}
+
+type optionFunc func(p *Provider)
+
+func (f optionFunc) apply(p *Provider) {
+	f(p)
+}
+
+// WithBaseURI sets the URI that file paths are appended to. It defaults to
+// "file:///".
+func WithBaseURI(uri string) Option {
+	return optionFunc(func(p *Provider) {
+		p.baseURI = uri
+	})
+}
+
+// WithInclude only exposes files that match one of the glob patterns.
+// Patterns use the syntax of [path.Match], plus "**" for any number of
+// directories. A pattern without a slash is matched against the file's base
+// name, anything else against its full slash-separated path.
+func WithInclude(patterns ...string) Option {
+	return optionFunc(func(p *Provider) {
+		p.include = append(p.include, patterns...)
+	})
+}
+
+// WithExclude hides files and directories that match one of the glob
+// patterns, using the same syntax as [WithInclude]. Excluded directories are
+// not descended into.
+func WithExclude(patterns ...string) Option {
+	return optionFunc(func(p *Provider) {
+		p.exclude = append(p.exclude, patterns...)
+	})
+}
+
+// WithMaxFileSize hides files larger than n bytes.
+func WithMaxFileSize(n int64) Option {
+	return optionFunc(func(p *Provider) {
+		p.maxSize = n
+	})
+}
+
+// WithPageSize sets the number of resources returned per resources/list page.
+func WithPageSize(n int) Option {
+	return optionFunc(func(p *Provider) {
+		p.pageSize = n
+	})
+}
+
+// New returns a Provider for fsys. It panics if the base URI can't be used
+// in a URI template.
+func New(fsys fs.FS, opts ...Option) *Provider {
+	p := &Provider{
+		fsys:     fsys,
+		baseURI:  "file:///",
+		pageSize: DefaultPageSize,
+		subs:     map[*mcp.Session]map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt.apply(p)
+	}
+	if p.pageSize <= 0 {
+		p.pageSize = DefaultPageSize
+	}
+	p.template = uritemplate.MustParse(p.baseURI + "{+path}")
+	return p
+}
+
+// Register adds the provider's handlers for resources/list,
+// resources/templates/list, resources/read, resources/subscribe and
+// resources/unsubscribe to r.
+func (p *Provider) Register(r mcp.Registrar) {
+	mcp.Handle(r, mcp.MethodListResources, p.ListResources)
+	mcp.Handle(r, mcp.MethodListResourceTemplates, p.ListResourceTemplates)
+	mcp.Handle(r, mcp.MethodReadResource, p.ReadResource)
+	mcp.Handle(r, mcp.MethodSubscribe, p.Subscribe)
+	mcp.Handle(r, mcp.MethodUnsubscribe, p.Unsubscribe)
+}
+
+// Capabilities returns the resource capabilities of a watched provider, for
+// use with [mcp.WithCapabilities].
+func (p *Provider) Capabilities() *mcp.Resources {
+	return &mcp.Resources{Subscribe: true, ListChanged: true}
+}
+
+// URI returns the resource URI of the file with the given slash-separated
+// path.
+func (p *Provider) URI(name string) string {
+	if name == "." {
+		return p.baseURI
+	}
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return p.baseURI + strings.Join(segments, "/")
+}
+
+// path returns the file path a resource URI refers to.
+func (p *Provider) path(uri string) (string, bool) {
+	vars, ok := p.template.Match(uri)
+	if !ok {
+		return "", false
+	}
+	name := strings.TrimSuffix(vars["path"], "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func (p *Provider) ListResources(ctx context.Context, req *mcp.Request[mcp.ListResourcesRequest]) (*mcp.Response[mcp.ListResourcesResponse], error) {
+	after := ""
+	if req.Params.Cursor != "" {
+		bs, err := base64.RawURLEncoding.DecodeString(req.Params.Cursor)
+		if err != nil {
+			return nil, mcp.NewError(mcp.CodeInvalidParams, fmt.Errorf("invalid cursor: %q", req.Params.Cursor))
+		}
+		after = string(bs)
+	}
+
+	names, err := p.page(after, p.pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &mcp.ListResourcesResponse{
+		Resources: []mcp.Resource{},
+	}
+	if len(names) > p.pageSize {
+		names = names[:p.pageSize]
+		result.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(names[len(names)-1]))
+	}
+	for _, name := range names {
+		result.Resources = append(result.Resources, mcp.Resource{
+			URI:      p.URI(name),
+			Name:     name,
+			MimeType: mime.TypeByExtension(path.Ext(name)),
+		})
+	}
+	return mcp.NewResponse(result), nil
+}
+
+// page returns up to n exposed files that come after the given path in walk
+// order. Once Watch has scanned the file system its snapshot is used instead
+// of walking it again.
+func (p *Provider) page(after string, n int) ([]string, error) {
+	p.mu.Lock()
+	if p.names != nil {
+		defer p.mu.Unlock()
+		i, found := slices.BinarySearchFunc(p.names, after, comparePaths)
+		if found {
+			i++
+		}
+		end := min(i+n, len(p.names))
+		return slices.Clone(p.names[i:end]), nil
+	}
+	p.mu.Unlock()
+
+	var names []string
+	err := p.walk(func(name string, d fs.DirEntry) error {
+		if after != "" && comparePaths(name, after) <= 0 {
+			if d.IsDir() && !strings.HasPrefix(after, name+"/") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		names = append(names, name)
+		if len(names) == n {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return names, err
+}
+
+// walk calls fn for every directory and exposed file in walk order, skipping
+// excluded directories.
+func (p *Provider) walk(fn func(name string, d fs.DirEntry) error) error {
+	return fs.WalkDir(p.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if matchAny(p.exclude, name) {
+				return fs.SkipDir
+			}
+			return fn(name, d)
+		}
+		if !d.Type().IsRegular() || !p.exposed(name) {
+			return nil
+		}
+		if p.maxSize > 0 {
+			info, err := d.Info()
+			if err != nil || info.Size() > p.maxSize {
+				return nil
+			}
+		}
+		return fn(name, d)
+	})
+}
+
+// exposed reports whether the include and exclude patterns let a file
+// through.
+func (p *Provider) exposed(name string) bool {
+	if matchAny(p.exclude, name) {
+		return false
+	}
+	return len(p.include) == 0 || matchAny(p.include, name)
+}
+
+// hidden reports whether a directory on the way to name is excluded.
+func (p *Provider) hidden(name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if matchAny(p.exclude, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) ListResourceTemplates(ctx context.Context, req *mcp.Request[mcp.ListResourceTemplatesRequest]) (*mcp.Response[mcp.ListResourceTemplatesResponse], error) {
+	return mcp.NewResponse(&mcp.ListResourceTemplatesResponse{
+		Templates: []mcp.ResourceTemplate{
+			{
+				URITemplate: p.template.String(),
+				Name:        "files",
+				Description: "A file or directory. Reading a directory returns the URIs of its entries as a text/uri-list.",
+			},
+		},
+	}), nil
+}
+
+func (p *Provider) ReadResource(ctx context.Context, req *mcp.Request[mcp.ReadResourceRequest]) (*mcp.Response[mcp.ReadResourceResponse], error) {
+	uri := req.Params.URI
+	name, ok := p.path(uri)
+	if !ok || p.hidden(name) {
+		return nil, mcp.ResourceNotFound(uri)
+	}
+	info, err := fs.Stat(p.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, mcp.ResourceNotFound(uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content mcp.ResourceContent
+	if info.IsDir() {
+		if name != "." && matchAny(p.exclude, name) {
+			return nil, mcp.ResourceNotFound(uri)
+		}
+		content, err = p.readDir(uri, name)
+	} else {
+		if !info.Mode().IsRegular() || !p.exposed(name) {
+			return nil, mcp.ResourceNotFound(uri)
+		}
+		if p.maxSize > 0 && info.Size() > p.maxSize {
+			return nil, mcp.NewError(mcp.CodeInvalidParams, fmt.Errorf("%s is larger than %d bytes", name, p.maxSize))
+		}
+		content, err = p.readFile(uri, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewResponse(&mcp.ReadResourceResponse{
+		Contents: []mcp.ResourceContent{content},
+	}), nil
+}
+
+func (p *Provider) readFile(uri, name string) (mcp.ResourceContent, error) {
+	data, err := fs.ReadFile(p.fsys, name)
+	if err != nil {
+		return mcp.ResourceContent{}, err
+	}
+	content := mcp.ResourceContent{
+		URI:      uri,
+		MimeType: contentType(name, data),
+	}
+	if isText(content.MimeType, data) {
+		content.Text = string(data)
+	} else {
+		content.Blob = base64.StdEncoding.EncodeToString(data)
+	}
+	return content, nil
+}
+
+// readDir lists the exposed entries of a directory as a text/uri-list.
+// Directory URIs end in a slash.
+func (p *Provider) readDir(uri, name string) (mcp.ResourceContent, error) {
+	entries, err := fs.ReadDir(p.fsys, name)
+	if err != nil {
+		return mcp.ResourceContent{}, err
+	}
+	var b strings.Builder
+	for _, e := range entries {
+		child := path.Join(name, e.Name())
+		if e.IsDir() {
+			if matchAny(p.exclude, child) {
+				continue
+			}
+			b.WriteString(p.URI(child) + "/\r\n")
+			continue
+		}
+		if !e.Type().IsRegular() || !p.exposed(child) {
+			continue
+		}
+		if p.maxSize > 0 {
+			if info, err := e.Info(); err != nil || info.Size() > p.maxSize {
+				continue
+			}
+		}
+		b.WriteString(p.URI(child) + "\r\n")
+	}
+	return mcp.ResourceContent{
+		URI:      uri,
+		MimeType: "text/uri-list",
+		Text:     b.String(),
+	}, nil
+}
+
+// contentType guesses the MIME type of a file from its extension, falling
+// back to sniffing its content.
+func contentType(name string, data []byte) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// isText reports whether a file can be sent as text rather than a blob.
+func isText(mimeType string, data []byte) bool {
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		strings.HasSuffix(mt, "+json"),
+		strings.HasSuffix(mt, "+xml"),
+		strings.HasSuffix(mt, "+yaml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-javascript", "application/yaml", "application/x-yaml",
+		"application/toml", "application/x-sh", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// comparePaths orders slash-separated paths the way [fs.WalkDir] visits
+// them: element by element.
+func comparePaths(a, b string) int {
+	for {
+		ai, bi := strings.IndexByte(a, '/'), strings.IndexByte(b, '/')
+		ae, be := a, b
+		if ai >= 0 {
+			ae = a[:ai]
+		}
+		if bi >= 0 {
+			be = b[:bi]
+		}
+		if c := strings.Compare(ae, be); c != 0 {
+			return c
+		}
+		switch {
+		case ai < 0 && bi < 0:
+			return 0
+		case ai < 0:
+			return -1
+		case bi < 0:
+			return 1
+		}
+		a, b = a[ai+1:], b[bi+1:]
+	}
+}
@@ -0,0 +1,214 @@
+package fsresource
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"README.md":         {Data: []byte("# Hello")},
+		"a.txt":             {Data: []byte("a")},
+		"a/b.txt":           {Data: []byte("b")},
+		"a/c.go":            {Data: []byte("package c")},
+		"img/logo.png":      {Data: []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		"data/blob":         {Data: []byte{0xff, 0x00, 0x01}},
+		"data/notes":        {Data: []byte("plain words")},
+		"node_modules/x.js": {Data: []byte("x")},
+		"big.txt":           {Data: make([]byte, 2048)},
+		"with space.txt":    {Data: []byte("spaced")},
+	}
+}
+
+func list(t *testing.T, p *Provider) []string {
+	t.Helper()
+	var names []string
+	cursor := ""
+	for {
+		resp, err := p.ListResources(context.Background(), mcp.NewRequest(&mcp.ListResourcesRequest{Cursor: cursor}))
+		if err != nil {
+			t.Fatalf("failed to list resources: %v", err)
+		}
+		for _, r := range resp.Result.Resources {
+			names = append(names, r.Name)
+		}
+		if resp.Result.NextCursor == "" {
+			return names
+		}
+		cursor = resp.Result.NextCursor
+	}
+}
+
+func read(p *Provider, uri string) (mcp.ResourceContent, error) {
+	resp, err := p.ReadResource(context.Background(), mcp.NewRequest(&mcp.ReadResourceRequest{URI: uri}))
+	if err != nil {
+		return mcp.ResourceContent{}, err
+	}
+	return resp.Result.Contents[0], nil
+}
+
+func TestList(t *testing.T) {
+	want := []string{
+		"README.md", "a/b.txt", "a/c.go", "a.txt", "big.txt", "data/blob", "data/notes",
+		"img/logo.png", "node_modules/x.js", "with space.txt",
+	}
+	for _, pageSize := range []int{1, 3, 100} {
+		p := New(testFS(), WithPageSize(pageSize))
+		if got := list(t, p); !slices.Equal(got, want) {
+			t.Fatalf("page size %d: got %v, want %v", pageSize, got, want)
+		}
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	p := New(testFS(),
+		WithInclude("*.txt", "*.go", "data/**"),
+		WithExclude("node_modules", "data/blob"),
+		WithMaxFileSize(1024),
+	)
+	want := []string{"a/b.txt", "a/c.go", "a.txt", "data/notes", "with space.txt"}
+	if got := list(t, p); !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	for _, uri := range []string{"file:///node_modules/x.js", "file:///README.md", "file:///data/blob"} {
+		var rpcErr *mcp.Error
+		if _, err := read(p, uri); !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeResourceNotFound {
+			t.Errorf("%s: expected resource not found, got %v", uri, err)
+		}
+	}
+	if _, err := read(p, "file:///big.txt"); err == nil {
+		t.Error("expected an error reading a file over the size limit")
+	}
+}
+
+func TestListInvalidCursor(t *testing.T) {
+	p := New(testFS())
+	_, err := p.ListResources(context.Background(), mcp.NewRequest(&mcp.ListResourcesRequest{Cursor: "!"}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	p := New(testFS())
+	for _, tc := range []struct {
+		uri      string
+		mimeType string
+		text     string
+		blob     []byte
+	}{
+		{uri: "file:///a/b.txt", mimeType: "text/plain; charset=utf-8", text: "b"},
+		{uri: "file:///with%20space.txt", mimeType: "text/plain; charset=utf-8", text: "spaced"},
+		{uri: "file:///data/notes", mimeType: "text/plain; charset=utf-8", text: "plain words"},
+		{uri: "file:///data/blob", mimeType: "application/octet-stream", blob: []byte{0xff, 0x00, 0x01}},
+		{uri: "file:///img/logo.png", mimeType: "image/png", blob: []byte("\x89PNG\r\n\x1a\n\x00\x00")},
+		{uri: "file:///a/", mimeType: "text/uri-list", text: "file:///a/b.txt\r\nfile:///a/c.go\r\n"},
+	} {
+		t.Run(tc.uri, func(t *testing.T) {
+			c, err := read(p, tc.uri)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if c.URI != tc.uri || c.MimeType != tc.mimeType {
+				t.Fatalf("unexpected content: %+v", c)
+			}
+			if tc.blob != nil {
+				if c.Text != "" || c.Blob != base64.StdEncoding.EncodeToString(tc.blob) {
+					t.Fatalf("expected blob, got %+v", c)
+				}
+			} else if c.Blob != "" || c.Text != tc.text {
+				t.Fatalf("expected text %q, got %+v", tc.text, c)
+			}
+		})
+	}
+
+	for _, uri := range []string{"file:///missing", "file:///../etc/passwd", "http://example.com/a.txt"} {
+		var rpcErr *mcp.Error
+		if _, err := read(p, uri); !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeResourceNotFound {
+			t.Errorf("%s: expected resource not found, got %v", uri, err)
+		}
+	}
+}
+
+type notifier struct {
+	listChanged int
+	updated     []string
+}
+
+func (n *notifier) ResourcesListChanged(ctx context.Context) error {
+	n.listChanged++
+	return nil
+}
+
+func (n *notifier) ResourceUpdated(ctx context.Context, uri string) error {
+	n.updated = append(n.updated, uri)
+	return nil
+}
+
+func TestPoll(t *testing.T) {
+	ctx := context.Background()
+	fsys := testFS()
+	p := New(fsys)
+	if err := p.poll(ctx, nil); err != nil {
+		t.Fatalf("failed to scan: %v", err)
+	}
+	for _, uri := range []string{"file:///a.txt", "file:///a/b.txt"} {
+		if _, err := p.Subscribe(ctx, mcp.NewRequest(&mcp.SubscribeRequest{URI: uri})); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+	}
+
+	n := &notifier{}
+	if err := p.poll(ctx, n); err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+	if n.listChanged != 0 || len(n.updated) != 0 {
+		t.Fatalf("unexpected notifications without changes: %+v", n)
+	}
+
+	fsys["a.txt"] = &fstest.MapFile{Data: []byte("changed"), ModTime: time.Now()}
+	fsys["README.md"] = &fstest.MapFile{Data: []byte("# Changed"), ModTime: time.Now()}
+	delete(fsys, "a/b.txt")
+	fsys["new.txt"] = &fstest.MapFile{Data: []byte("new")}
+	if err := p.poll(ctx, n); err != nil {
+		t.Fatalf("failed to poll: %v", err)
+	}
+	if n.listChanged != 1 {
+		t.Fatalf("expected one list_changed notification, got %d", n.listChanged)
+	}
+	if want := []string{"file:///a.txt", "file:///a/b.txt"}; !slices.Equal(n.updated, want) {
+		t.Fatalf("got updates %v, want %v", n.updated, want)
+	}
+	if got := list(t, p); !slices.Contains(got, "new.txt") || slices.Contains(got, "a/b.txt") {
+		t.Fatalf("listing doesn't reflect the latest scan: %v", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "a/b/c.go", true},
+		{"*.go", "c.txt", false},
+		{"a/*.go", "a/c.go", true},
+		{"a/*.go", "a/b/c.go", false},
+		{"a/**/*.go", "a/c.go", true},
+		{"a/**/*.go", "a/b/d/c.go", true},
+		{"**/testdata", "x/y/testdata", true},
+		{"**", "anything/at/all", true},
+	} {
+		if got := match(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package fsresource
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+// A Notifier sends resource change notifications to a client. [*mcp.Server]
+// is a Notifier.
+type Notifier interface {
+	ResourcesListChanged(ctx context.Context) error
+	ResourceUpdated(ctx context.Context, uri string) error
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Subscribe subscribes the session of the request to updates of a file.
+// Updates for requests made outside of a session are sent through the
+// [Notifier] passed to [Provider.Watch].
+func (p *Provider) Subscribe(ctx context.Context, req *mcp.Request[mcp.SubscribeRequest]) (*mcp.Response[mcp.SubscribeResponse], error) {
+	if _, ok := p.path(req.Params.URI); !ok {
+		return nil, mcp.ResourceNotFound(req.Params.URI)
+	}
+	sess := mcp.SessionFromContext(ctx)
+	p.mu.Lock()
+	if p.subs[sess] == nil {
+		p.subs[sess] = map[string]bool{}
+	}
+	p.subs[sess][req.Params.URI] = true
+	p.mu.Unlock()
+	return mcp.NewResponse(&mcp.SubscribeResponse{}), nil
+}
+
+// Unsubscribe cancels a subscription made by the session of the request.
+func (p *Provider) Unsubscribe(ctx context.Context, req *mcp.Request[mcp.UnsubscribeRequest]) (*mcp.Response[mcp.UnsubscribeResponse], error) {
+	sess := mcp.SessionFromContext(ctx)
+	p.mu.Lock()
+	delete(p.subs[sess], req.Params.URI)
+	if len(p.subs[sess]) == 0 {
+		delete(p.subs, sess)
+	}
+	p.mu.Unlock()
+	return mcp.NewResponse(&mcp.UnsubscribeResponse{}), nil
+}
+
+// EndSession drops the subscriptions of a session that has ended. Pass it
+// to [mcp.OnSessionEnd].
+func (p *Provider) EndSession(ctx context.Context, s *mcp.Session) {
+	p.mu.Lock()
+	delete(p.subs, s)
+	p.mu.Unlock()
+}
+
+// Watch polls the file system every interval until ctx is done. When exposed
+// files are added or removed it sends a list_changed notification, and when a
+// file a session subscribed to is modified or removed it sends an updated
+// notification to that session. Files are compared by size and modification
+// time.
+//
+// While Watch runs, resources/list is served from the latest scan rather than
+// by walking the file system. Watch returns ctx.Err() once ctx is done, or
+// the first error from scanning the file system or sending a notification
+// through n. Updates for sessions that have ended are dropped.
+func (p *Provider) Watch(ctx context.Context, n Notifier, interval time.Duration) error {
+	if err := p.poll(ctx, nil); err != nil {
+		return err
+	}
+	defer func() {
+		p.mu.Lock()
+		p.files, p.names = nil, nil
+		p.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := p.poll(ctx, n); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// poll scans the file system, replaces the snapshot and sends notifications
+// for the differences to the previous one. A nil Notifier only takes the
+// snapshot.
+func (p *Provider) poll(ctx context.Context, n Notifier) error {
+	files := map[string]fileState{}
+	var names []string
+	err := p.walk(func(name string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[name] = fileState{size: info.Size(), modTime: info.ModTime()}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	p.mu.Lock()
+	old := p.files
+	p.files, p.names = files, names
+	updated := map[*mcp.Session][]string{}
+	for sess, uris := range p.subs {
+		for uri := range uris {
+			name, ok := p.path(uri)
+			if !ok {
+				continue
+			}
+			before, existed := old[name]
+			after, exists := files[name]
+			if existed && (!exists || before.size != after.size || !before.modTime.Equal(after.modTime)) {
+				updated[sess] = append(updated[sess], uri)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if n == nil {
+		return nil
+	}
+	if !maps.EqualFunc(old, files, func(fileState, fileState) bool { return true }) {
+		if err := n.ResourcesListChanged(ctx); err != nil {
+			return err
+		}
+	}
+	for sess, uris := range updated {
+		slices.Sort(uris)
+		for _, uri := range uris {
+			if sess == nil {
+				if err := n.ResourceUpdated(ctx, uri); err != nil {
+					return err
+				}
+				continue
+			}
+			// The session may have ended since the scan; it no longer
+			// needs the update.
+			sess.ResourceUpdated(ctx, uri)
+		}
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ type stack struct {
 }
 
 func newStack(interceptors []Interceptor) *stack {
+	interceptors = slices.Clone(interceptors)
 	slices.Reverse(interceptors)
 	return &stack{interceptors: interceptors}
 }
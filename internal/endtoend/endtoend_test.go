@@ -3,11 +3,25 @@ package endtoend
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/riza-io/mcp-go"
+	"github.com/riza-io/mcp-go/auth"
+	"github.com/riza-io/mcp-go/fsresource"
+	"github.com/riza-io/mcp-go/ratelimit"
 	"github.com/riza-io/mcp-go/stdio"
+	"github.com/riza-io/mcp-go/tasks"
 )
 
 type server struct {
@@ -56,13 +70,13 @@ func TestEndToEnd(t *testing.T) {
 
 	go func() {
 		if err := s.Listen(ctx); err != nil {
-			t.Fatalf("failed to listen: %v", err)
+			t.Errorf("failed to listen: %v", err)
 		}
 	}()
 
 	go func() {
 		if err := c.Listen(ctx); err != nil {
-			t.Fatalf("failed to listen: %v", err)
+			t.Errorf("failed to listen: %v", err)
 		}
 	}()
 
@@ -76,6 +90,26 @@ func TestEndToEnd(t *testing.T) {
 		if resp.Result.ProtocolVersion != "1.0.0" {
 			t.Fatalf("expected protocol version 1.0.0, got %s", resp.Result.ProtocolVersion)
 		}
+		if resp.Result.Capabilities.Tools != nil {
+			t.Fatalf("expected no tools capability, got %+v", resp.Result.Capabilities.Tools)
+		}
+		if c.ServerCapabilities() == nil {
+			t.Fatalf("expected client to store server capabilities")
+		}
+		if s.ClientCapabilities() == nil {
+			t.Fatalf("expected server to store client capabilities")
+		}
+	})
+
+	t.Run("client/unsupportedCapability", func(t *testing.T) {
+		_, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		var capErr *mcp.CapabilityError
+		if !errors.As(err, &capErr) {
+			t.Fatalf("expected capability error, got %v", err)
+		}
+		if capErr.Capability != "tools" {
+			t.Fatalf("expected tools capability, got %s", capErr.Capability)
+		}
 	})
 
 	t.Run("client/ping", func(t *testing.T) {
@@ -111,4 +145,2413 @@ func TestEndToEnd(t *testing.T) {
 			t.Fatalf("failed to set log level: %v", err)
 		}
 	})
+
+	// The client handles the log message in the background; its logging
+	// interceptor must be done before the test ends.
+	if err := c.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shut down client: %v", err)
+	}
+}
+
+// connect starts a server and a client talking over in-memory pipes and
+// initializes the client.
+func connect(t *testing.T, handler mcp.ServerHandler, opts ...mcp.ServerOption) (*mcp.Client, *mcp.Server) {
+	t.Helper()
+	return connectClient(t, handler, nil, opts...)
+}
+
+func connectClient(t *testing.T, handler mcp.ServerHandler, clientOpts []mcp.ClientOption, opts ...mcp.ServerOption) (*mcp.Client, *mcp.Server) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stdinr, stdinw := io.Pipe()
+	stdoutr, stdoutw := io.Pipe()
+
+	c := mcp.NewClient(stdio.NewStream(stdinr, stdoutw), &client{}, clientOpts...)
+	s := mcp.NewServer(stdio.NewStream(stdoutr, stdinw), handler, opts...)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); s.Listen(ctx) }()
+	go func() { defer wg.Done(); c.Listen(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		stdinr.Close()
+		stdinw.Close()
+		stdoutr.Close()
+		stdoutw.Close()
+		wg.Wait()
+	})
+
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{
+		ProtocolVersion: "1.0.0",
+	})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+	return c, s
+}
+
+func TestDerivedCapabilities(t *testing.T) {
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListPrompts, func(ctx context.Context, req *mcp.Request[mcp.ListPromptsRequest]) (*mcp.Response[mcp.ListPromptsResponse], error) {
+		return mcp.NewResponse(&mcp.ListPromptsResponse{}), nil
+	})
+	mcp.Handle(mux, mcp.MethodSetLogLevel, func(ctx context.Context, req *mcp.Request[mcp.SetLogLevelRequest]) (*mcp.Response[mcp.SetLogLevelResponse], error) {
+		return mcp.NewResponse(&mcp.SetLogLevelResponse{}), nil
+	})
+
+	for _, tc := range []struct {
+		name    string
+		handler mcp.ServerHandler
+		opts    []mcp.ServerOption
+		want    mcp.ServerCapabilities
+	}{
+		{"unimplemented", &mcp.UnimplementedServer{}, nil, mcp.ServerCapabilities{}},
+		// Overriding methods of UnimplementedServer advertises nothing.
+		{"embedded", &server{}, nil, mcp.ServerCapabilities{}},
+		{
+			"explicit", &server{},
+			[]mcp.ServerOption{mcp.WithCapabilities(mcp.ServerCapabilities{Logging: &mcp.Logging{}})},
+			mcp.ServerCapabilities{Logging: &mcp.Logging{}},
+		},
+		{"mux", mux, nil, mcp.ServerCapabilities{Logging: &mcp.Logging{}, Prompts: &mcp.Prompts{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := connect(t, tc.handler, tc.opts...)
+			got := *c.ServerCapabilities()
+			got.Experimental = nil
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got capabilities %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+type addArgs struct {
+	A int `json:"a" description:"first operand"`
+	B int `json:"b"`
+}
+
+func TestToolRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "add", Description: "Add two numbers"},
+		func(ctx context.Context, args addArgs) (map[string]int, error) {
+			return map[string]int{"sum": args.A + args.B}, nil
+		})
+	mcp.AddTool(tools, mcp.Tool{Name: "negate"},
+		func(ctx context.Context, args *addArgs) (int, error) {
+			return -args.A, nil
+		})
+
+	c, s := connect(t, &server{}, mcp.WithToolRegistry(tools))
+
+	if c.ServerCapabilities().Tools == nil {
+		t.Fatalf("expected tools capability to be derived from the registry")
+	}
+
+	t.Run("list", func(t *testing.T) {
+		resp, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+		if len(resp.Result.Tools) != 2 {
+			t.Fatalf("expected 2 tools, got %d", len(resp.Result.Tools))
+		}
+		var schema struct {
+			Type       string                     `json:"type"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		}
+		if err := json.Unmarshal(resp.Result.Tools[0].InputSchema, &schema); err != nil {
+			t.Fatalf("failed to decode input schema: %v", err)
+		}
+		if schema.Type != "object" || len(schema.Properties) != 2 || len(schema.Required) != 2 {
+			t.Fatalf("unexpected input schema: %s", resp.Result.Tools[0].InputSchema)
+		}
+	})
+
+	t.Run("call", func(t *testing.T) {
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+			Name:      "add",
+			Arguments: json.RawMessage(`{"a": 1, "b": 2}`),
+		}))
+		if err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+		if got := resp.Result.Content[0].Text; got != `{"sum":3}` {
+			t.Fatalf("unexpected result: %s", got)
+		}
+	})
+
+	t.Run("shadowed handler", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected Handle to panic")
+			}
+		}()
+		mcp.Handle(s, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+			return nil, nil
+		})
+	})
+
+	t.Run("pointer without arguments", func(t *testing.T) {
+		for _, args := range []json.RawMessage{nil, json.RawMessage("null")} {
+			resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+				Name:      "negate",
+				Arguments: args,
+			}))
+			if err != nil {
+				t.Fatalf("failed to call tool with arguments %s: %v", args, err)
+			}
+			if got := resp.Result.Content[0].Text; got != "0" {
+				t.Fatalf("unexpected result: %s", got)
+			}
+		}
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+			Name:      "add",
+			Arguments: json.RawMessage(`{"a": "one"}`),
+		}))
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+			t.Fatalf("expected invalid params error, got %v", err)
+		}
+	})
+
+	t.Run("unknown tool", func(t *testing.T) {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+			Name: "subtract",
+		}))
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+			t.Fatalf("expected invalid params error, got %v", err)
+		}
+	})
+}
+
+func TestToolArgumentValidation(t *testing.T) {
+	ctx := context.Background()
+
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "add"},
+		func(ctx context.Context, args addArgs) (string, error) {
+			return "ok", nil
+		})
+
+	c, _ := connect(t, &server{}, mcp.WithToolRegistry(tools), mcp.WithToolArgumentValidation())
+
+	_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+		Name:      "add",
+		Arguments: json.RawMessage(`{"a": 1.5}`),
+	}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+		t.Fatalf("expected invalid params error, got %v", err)
+	}
+	var data struct {
+		Errors []struct {
+			Path string `json:"path"`
+		} `json:"errors"`
+	}
+	raw, _ := rpcErr.Data().(json.RawMessage)
+	if err := json.Unmarshal(raw, &data); err != nil {
+		t.Fatalf("failed to decode error data %q: %v", raw, err)
+	}
+	if len(data.Errors) != 2 || data.Errors[0].Path != "/b" || data.Errors[1].Path != "/a" {
+		t.Fatalf("unexpected error data: %s", raw)
+	}
+}
+
+type weather struct {
+	Temperature float64 `json:"temperature"`
+	Conditions  string  `json:"conditions"`
+}
+
+func weatherTools() *mcp.ToolRegistry {
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "weather"},
+		func(ctx context.Context, args struct{}) (*weather, error) {
+			return &weather{Temperature: 21.5, Conditions: "sunny"}, nil
+		})
+	mcp.AddTool(tools, mcp.Tool{
+		Name:         "broken",
+		OutputSchema: json.RawMessage(`{"type": "object", "required": ["temperature"]}`),
+	}, func(ctx context.Context, args struct{}) (*mcp.CallToolResponse, error) {
+		return &mcp.CallToolResponse{
+			Content:           []mcp.Content{{Type: "text", Text: "{}"}},
+			StructuredContent: json.RawMessage(`{}`),
+		}, nil
+	})
+	return tools
+}
+
+func TestToolOutputValidation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("server", func(t *testing.T) {
+		c, _ := connect(t, &server{}, mcp.WithToolRegistry(weatherTools()), mcp.WithToolOutputValidation())
+
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "weather"}))
+		if err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+		if string(resp.Result.StructuredContent) != `{"temperature":21.5,"conditions":"sunny"}` {
+			t.Fatalf("unexpected structured content: %s", resp.Result.StructuredContent)
+		}
+
+		_, err = c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "broken"}))
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInternalError {
+			t.Fatalf("expected internal error, got %v", err)
+		}
+	})
+
+	t.Run("client", func(t *testing.T) {
+		c, _ := connectClient(t, &server{}, []mcp.ClientOption{mcp.WithToolOutputValidation()},
+			mcp.WithToolRegistry(weatherTools()))
+
+		resp, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+		if len(resp.Result.Tools[0].OutputSchema) == 0 {
+			t.Fatalf("expected an output schema for the weather tool")
+		}
+
+		if _, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "weather"})); err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+
+		_, err = c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "broken"}))
+		var outErr *mcp.ToolOutputError
+		if !errors.As(err, &outErr) || outErr.Err.Errors[0].Path != "/temperature" {
+			t.Fatalf("expected tool output error, got %v", err)
+		}
+	})
+}
+
+func TestPromptRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	review, err := mcp.NewPromptTemplate(
+		mcp.MessageTemplate{Role: mcp.RoleUser, Text: "Review this {{.language}} code{{if .focus}}, focusing on {{.focus}}{{end}}."},
+		mcp.MessageTemplate{Role: mcp.RoleUser, Resource: &mcp.ResourceContent{
+			URI:      "file:///{{.path}}",
+			MimeType: "text/plain",
+			Text:     "contents of {{.path}}",
+		}},
+		mcp.MessageTemplate{Role: mcp.RoleAssistant, Text: "Sure."},
+	)
+	if err != nil {
+		t.Fatalf("failed to parse template: %v", err)
+	}
+
+	prompts := mcp.NewPromptRegistry()
+	prompts.AddPrompt(mcp.Prompt{
+		Name: "review",
+		Arguments: []mcp.Argument{
+			{Name: "language", Required: true},
+			{Name: "path", Required: true},
+			{Name: "focus"},
+		},
+	}, review)
+
+	c, _ := connect(t, &server{}, mcp.WithPromptRegistry(prompts))
+
+	t.Run("get", func(t *testing.T) {
+		resp, err := c.GetPrompt(ctx, mcp.NewRequest(&mcp.GetPromptRequest{
+			Name:      "review",
+			Arguments: map[string]string{"language": "Go", "path": "main.go"},
+		}))
+		if err != nil {
+			t.Fatalf("failed to get prompt: %v", err)
+		}
+		msgs := resp.Result.Messages
+		if len(msgs) != 3 {
+			t.Fatalf("expected 3 messages, got %d", len(msgs))
+		}
+		if msgs[0].Content.Text != "Review this Go code." {
+			t.Fatalf("unexpected text: %q", msgs[0].Content.Text)
+		}
+		if r := msgs[1].Content.Resource; msgs[1].Content.Type != "resource" || r == nil || r.URI != "file:///main.go" {
+			t.Fatalf("unexpected resource message: %+v", msgs[1].Content)
+		}
+		if msgs[2].Role != mcp.RoleAssistant {
+			t.Fatalf("unexpected role: %s", msgs[2].Role)
+		}
+	})
+
+	t.Run("missing argument", func(t *testing.T) {
+		_, err := c.GetPrompt(ctx, mcp.NewRequest(&mcp.GetPromptRequest{
+			Name:      "review",
+			Arguments: map[string]string{"language": "Go"},
+		}))
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+			t.Fatalf("expected invalid params error, got %v", err)
+		}
+	})
+}
+
+func TestResourceRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	resources := mcp.NewResourceRegistry()
+	resources.AddResource(mcp.Resource{
+		URI:      "config://app",
+		Name:     "config",
+		MimeType: "application/json",
+	}, func(ctx context.Context, uri string) ([]mcp.ResourceContent, error) {
+		return []mcp.ResourceContent{{URI: uri, MimeType: "application/json", Text: `{"debug":true}`}}, nil
+	})
+	resources.AddResourceTemplate(mcp.ResourceTemplate{
+		URITemplate: "users://{id}/posts/{post}",
+		Name:        "post",
+		MimeType:    "text/plain",
+	}, func(ctx context.Context, uri string, vars map[string]string) ([]mcp.ResourceContent, error) {
+		if vars["id"] != "42" {
+			return nil, mcp.ResourceNotFound(uri)
+		}
+		return []mcp.ResourceContent{{URI: uri, MimeType: "text/plain", Text: "post " + vars["post"] + " by " + vars["id"]}}, nil
+	})
+	// A hidden resource isn't read through a template matching its URI.
+	resources.AddResource(mcp.Resource{
+		URI:  "users://42/posts/draft",
+		Name: "draft",
+	}, func(ctx context.Context, uri string) ([]mcp.ResourceContent, error) {
+		return []mcp.ResourceContent{{URI: uri, Text: "draft"}}, nil
+	}, mcp.WithDisabled())
+
+	c, _ := connect(t, &server{}, mcp.WithResourceRegistry(resources))
+
+	t.Run("capabilities", func(t *testing.T) {
+		if c.ServerCapabilities().Resources == nil {
+			t.Fatal("expected resources capability")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := c.ListResources(ctx, mcp.NewRequest(&mcp.ListResourcesRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list resources: %v", err)
+		}
+		if len(list.Result.Resources) != 1 || list.Result.Resources[0].URI != "config://app" {
+			t.Fatalf("unexpected resources: %+v", list.Result.Resources)
+		}
+		templates, err := c.ListResourceTemplates(ctx, mcp.NewRequest(&mcp.ListResourceTemplatesRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list resource templates: %v", err)
+		}
+		if len(templates.Result.Templates) != 1 || templates.Result.Templates[0].Name != "post" {
+			t.Fatalf("unexpected templates: %+v", templates.Result.Templates)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		for uri, want := range map[string]string{
+			"config://app":       `{"debug":true}`,
+			"users://42/posts/7": "post 7 by 42",
+		} {
+			resp, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: uri}))
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", uri, err)
+			}
+			if len(resp.Result.Contents) != 1 || resp.Result.Contents[0].Text != want {
+				t.Fatalf("unexpected contents for %s: %+v", uri, resp.Result.Contents)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		for _, uri := range []string{"config://other", "users://7/posts/1", "users://42/posts/draft"} {
+			_, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: uri}))
+			var rpcErr *mcp.Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeResourceNotFound {
+				t.Fatalf("expected resource not found error for %s, got %v", uri, err)
+			}
+		}
+	})
+}
+
+func TestMux(t *testing.T) {
+	ctx := context.Background()
+
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{
+			Tools: []mcp.Tool{{Name: "echo", InputSchema: json.RawMessage(`{"type":"object"}`)}},
+		}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		return mcp.NewResponse(&mcp.CallToolResponse{
+			Content: []mcp.Content{{Type: "text", Text: string(req.Params.Arguments)}},
+		}), nil
+	})
+
+	var listed int
+	mcp.Handle(mux, mcp.MethodListPrompts, func(ctx context.Context, req *mcp.Request[mcp.ListPromptsRequest]) (*mcp.Response[mcp.ListPromptsResponse], error) {
+		listed++
+		return mcp.NewResponse(&mcp.ListPromptsResponse{}), nil
+	})
+
+	c, _ := connect(t, mux)
+
+	t.Run("capabilities", func(t *testing.T) {
+		caps := c.ServerCapabilities()
+		if caps.Tools == nil || caps.Prompts == nil {
+			t.Fatal("expected tools and prompts capabilities")
+		}
+		if listed != 0 {
+			t.Fatalf("initialize called the prompts/list handler %d times", listed)
+		}
+		if caps.Resources != nil {
+			t.Fatalf("unexpected capabilities: %+v", caps)
+		}
+	})
+
+	t.Run("call", func(t *testing.T) {
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{
+			Name:      "echo",
+			Arguments: json.RawMessage(`{"a":1}`),
+		}))
+		if err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+		if resp.Result.Content[0].Text != `{"a":1}` {
+			t.Fatalf("unexpected content: %+v", resp.Result.Content)
+		}
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		if _, err := c.Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+			t.Fatalf("failed to ping: %v", err)
+		}
+	})
+
+	t.Run("mismatched types", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected Handle to panic")
+			}
+		}()
+		mcp.Handle(mcp.NewMux(), mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[json.RawMessage]) (*mcp.Response[mcp.CallToolResponse], error) {
+			return nil, nil
+		})
+	})
+}
+
+type rebuildRequest struct {
+	Index string `json:"index"`
+}
+
+type rebuildResponse struct {
+	Documents int `json:"documents"`
+}
+
+type progressNotification struct {
+	Done int `json:"done"`
+}
+
+func TestCustomMethods(t *testing.T) {
+	ctx := context.Background()
+
+	var intercepted []string
+	interceptor := mcp.UnaryInterceptorFunc(func(next mcp.UnaryFunc) mcp.UnaryFunc {
+		return func(ctx context.Context, req mcp.AnyRequest) (mcp.AnyResponse, error) {
+			intercepted = append(intercepted, req.Method())
+			return next(ctx, req)
+		}
+	})
+
+	c, s := connectClient(t, &server{},
+		[]mcp.ClientOption{mcp.WithExperimentalCapability("x-acme/progress", nil)},
+		mcp.WithExperimentalCapability("x-acme/index", json.RawMessage(`{"version":2}`)),
+		mcp.WithInterceptors(interceptor),
+	)
+
+	mcp.Handle(s, "x-acme/index/rebuild", func(ctx context.Context, req *mcp.Request[rebuildRequest]) (*mcp.Response[rebuildResponse], error) {
+		if req.Params.Index != "docs" {
+			return nil, mcp.NewError(mcp.CodeInvalidParams, errors.New("unknown index"))
+		}
+		return mcp.NewResponse(&rebuildResponse{Documents: 3}), nil
+	})
+
+	progress := make(chan int, 1)
+	mcp.HandleNotification(c, "x-acme/progress", func(ctx context.Context, req *mcp.Request[progressNotification]) error {
+		progress <- req.Params.Done
+		return nil
+	})
+
+	t.Run("capabilities", func(t *testing.T) {
+		caps := c.ServerCapabilities()
+		if got := string(caps.Experimental["x-acme/index"]); got != `{"version":2}` {
+			t.Fatalf("unexpected experimental capability: %s", got)
+		}
+		if _, ok := s.ClientCapabilities().Experimental["x-acme/progress"]; !ok {
+			t.Fatalf("expected client experimental capability, got %+v", s.ClientCapabilities())
+		}
+	})
+
+	t.Run("initialize request unchanged", func(t *testing.T) {
+		params := &mcp.InitializeRequest{ProtocolVersion: "1.0.0"}
+		req := mcp.NewRequest(params)
+		c.Initialize(ctx, req)
+		if req.Params != params || params.Capabilities.Experimental != nil {
+			t.Fatalf("expected the request to be left alone, got %+v", req.Params)
+		}
+	})
+
+	t.Run("call", func(t *testing.T) {
+		intercepted = nil
+		resp, err := mcp.Call[rebuildRequest, rebuildResponse](ctx, c, "x-acme/index/rebuild", mcp.NewRequest(&rebuildRequest{Index: "docs"}))
+		if err != nil {
+			t.Fatalf("failed to call: %v", err)
+		}
+		if resp.Result.Documents != 3 {
+			t.Fatalf("unexpected result: %+v", resp.Result)
+		}
+		if len(intercepted) != 1 || intercepted[0] != "x-acme/index/rebuild" {
+			t.Fatalf("expected the server interceptor to run, got %v", intercepted)
+		}
+	})
+
+	t.Run("notify", func(t *testing.T) {
+		if err := mcp.Notify(ctx, s, "x-acme/progress", mcp.NewRequest(&progressNotification{Done: 5})); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+		if done := <-progress; done != 5 {
+			t.Fatalf("unexpected progress: %d", done)
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		_, err := mcp.Call[rebuildRequest, rebuildResponse](ctx, c, "x-acme/unknown", mcp.NewRequest(&rebuildRequest{}))
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeMethodNotFound {
+			t.Fatalf("expected method not found error, got %v", err)
+		}
+	})
+}
+
+func TestResourceSubscriptions(t *testing.T) {
+	ctx := context.Background()
+
+	files := fsresource.New(fstest.MapFS{
+		"notes.txt": {Data: []byte("hello")},
+	})
+	mux := mcp.NewMux()
+	files.Register(mux)
+
+	c, s := connect(t, mux, mcp.WithCapabilities(mcp.ServerCapabilities{
+		Resources: files.Capabilities(),
+	}))
+
+	updated := make(chan string, 1)
+	mcp.HandleNotification(c, mcp.MethodResourceUpdated, func(ctx context.Context, req *mcp.Request[mcp.ResourceUpdatedNotification]) error {
+		updated <- req.Params.URI
+		return nil
+	})
+
+	if caps := c.ServerCapabilities().Resources; caps == nil || !caps.Subscribe || !caps.ListChanged {
+		t.Fatalf("unexpected resource capabilities: %+v", caps)
+	}
+
+	resp, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: "file:///notes.txt"}))
+	if err != nil {
+		t.Fatalf("failed to read resource: %v", err)
+	}
+	if resp.Result.Contents[0].Text != "hello" {
+		t.Fatalf("unexpected contents: %+v", resp.Result.Contents)
+	}
+
+	if _, err := c.Subscribe(ctx, mcp.NewRequest(&mcp.SubscribeRequest{URI: "file:///notes.txt"})); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := s.ResourceUpdated(ctx, "file:///notes.txt"); err != nil {
+		t.Fatalf("failed to send update: %v", err)
+	}
+	if uri := <-updated; uri != "file:///notes.txt" {
+		t.Fatalf("unexpected update for %s", uri)
+	}
+	if _, err := c.Unsubscribe(ctx, mcp.NewRequest(&mcp.UnsubscribeRequest{URI: "file:///notes.txt"})); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+}
+
+// lockedFS lets a test change files while a provider polls them.
+type lockedFS struct {
+	mu   sync.Mutex
+	fsys fstest.MapFS
+}
+
+func (l *lockedFS) Open(name string) (fs.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fsys.Open(name)
+}
+
+func (l *lockedFS) write(name, data string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.fsys[name] = &fstest.MapFile{Data: []byte(data), ModTime: time.Now()}
+}
+
+func TestResourceSubscriptionsPerSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fsys := &lockedFS{fsys: fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+		"b.txt": {Data: []byte("b")},
+	}}
+	files := fsresource.New(fsys)
+	mux := mcp.NewMux()
+	files.Register(mux)
+
+	h := newHub()
+	s := mcp.NewServer(h, mux,
+		mcp.WithCapabilities(mcp.ServerCapabilities{Resources: files.Capabilities()}),
+		mcp.OnSessionEnd(files.EndSession),
+	)
+	go s.Listen(ctx)
+
+	updated := map[string]chan string{}
+	clients := map[string]*mcp.Client{}
+	for _, id := range []string{"a", "b"} {
+		c := mcp.NewClient(h.connect(id), &client{})
+		go c.Listen(ctx)
+		ch := make(chan string, 4)
+		mcp.HandleNotification(c, mcp.MethodResourceUpdated, func(ctx context.Context, req *mcp.Request[mcp.ResourceUpdatedNotification]) error {
+			ch <- req.Params.URI
+			return nil
+		})
+		if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+			t.Fatalf("failed to initialize client %s: %v", id, err)
+		}
+		updated[id], clients[id] = ch, c
+	}
+
+	for _, sub := range []struct{ client, uri string }{
+		{"a", "file:///a.txt"},
+		{"b", "file:///a.txt"},
+		{"b", "file:///b.txt"},
+	} {
+		if _, err := clients[sub.client].Subscribe(ctx, mcp.NewRequest(&mcp.SubscribeRequest{URI: sub.uri})); err != nil {
+			t.Fatalf("failed to subscribe %s to %s: %v", sub.client, sub.uri, err)
+		}
+	}
+	if _, err := clients["b"].Unsubscribe(ctx, mcp.NewRequest(&mcp.UnsubscribeRequest{URI: "file:///a.txt"})); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+
+	go files.Watch(ctx, s, 5*time.Millisecond)
+
+	// Changes made before Watch takes its first snapshot go unnoticed, so
+	// keep changing a.txt until a hears about it.
+	deadline := time.After(5 * time.Second)
+	for done := false; !done; {
+		fsys.write("a.txt", time.Now().String())
+		select {
+		case uri := <-updated["a"]:
+			if uri != "file:///a.txt" {
+				t.Fatalf("client a got an update for %s", uri)
+			}
+			done = true
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("client a got no update")
+		}
+	}
+
+	// Updates to a session arrive in order, so b's first update must be
+	// for the file it is still subscribed to.
+	fsys.write("b.txt", "changed")
+	select {
+	case uri := <-updated["b"]:
+		if uri != "file:///b.txt" {
+			t.Fatalf("client b got an update for %s after unsubscribing", uri)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("client b got no update")
+	}
+}
+
+func TestWatchWithoutSessions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fsys := &lockedFS{fsys: fstest.MapFS{
+		"a.txt": {Data: []byte("a")},
+	}}
+	files := fsresource.New(fsys)
+	mux := mcp.NewMux()
+	files.Register(mux)
+
+	h := newHub()
+	s := mcp.NewServer(h, mux,
+		mcp.WithCapabilities(mcp.ServerCapabilities{Resources: files.Capabilities()}),
+		mcp.OnSessionEnd(files.EndSession),
+	)
+	go s.Listen(ctx)
+
+	n := &signalingNotifier{Notifier: s, listChanged: make(chan error, 1)}
+	watched := make(chan error, 1)
+	go func() { watched <- files.Watch(ctx, n, 5*time.Millisecond) }()
+
+	// Nobody is connected to hear about these changes, which must not stop
+	// the watch. A second list_changed shows the watch outlived the first.
+	for i := range 2 {
+		for sent := false; !sent; {
+			fsys.write(fmt.Sprintf("new%d.txt", time.Now().UnixNano()), "new")
+			select {
+			case err := <-n.listChanged:
+				if err != nil {
+					t.Fatalf("list_changed without sessions failed: %v", err)
+				}
+				sent = true
+			case err := <-watched:
+				t.Fatalf("watch ended without sessions after %d changes: %v", i, err)
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}
+
+	c := mcp.NewClient(h.connect("a"), &client{})
+	go c.Listen(ctx)
+	updated := make(chan string, 4)
+	mcp.HandleNotification(c, mcp.MethodResourceUpdated, func(ctx context.Context, req *mcp.Request[mcp.ResourceUpdatedNotification]) error {
+		updated <- req.Params.URI
+		return nil
+	})
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+	if _, err := c.Subscribe(ctx, mcp.NewRequest(&mcp.SubscribeRequest{URI: "file:///a.txt"})); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	deadline := time.After(5 * time.Second)
+	for done := false; !done; {
+		fsys.write("a.txt", time.Now().String())
+		select {
+		case uri := <-updated:
+			if uri != "file:///a.txt" {
+				t.Fatalf("got an update for %s", uri)
+			}
+			done = true
+		case err := <-watched:
+			t.Fatalf("watch ended: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("late subscriber got no update")
+		}
+	}
+}
+
+// signalingNotifier reports the result of every list_changed notification
+// it forwards.
+type signalingNotifier struct {
+	fsresource.Notifier
+	listChanged chan error
+}
+
+func (n *signalingNotifier) ResourcesListChanged(ctx context.Context) error {
+	err := n.Notifier.ResourcesListChanged(ctx)
+	n.listChanged <- err
+	return err
+}
+
+func TestSessions(t *testing.T) {
+	ctx := context.Background()
+
+	calls := mcp.NewKey[int]("calls")
+	started := make(chan *mcp.Session, 1)
+	ended := make(chan *mcp.Session, 1)
+
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "count"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		sess := mcp.SessionFromContext(ctx)
+		n, _ := calls.Get(sess)
+		calls.Set(sess, n+1)
+		text := fmt.Sprintf("%s call %d", sess.InitializeRequest().ClientInfo.Name, n+1)
+		return mcp.NewResponse(&mcp.CallToolResponse{
+			Content: []mcp.Content{{Type: "text", Text: text}},
+		}), nil
+	})
+
+	stdinr, stdinw := io.Pipe()
+	stdoutr, stdoutw := io.Pipe()
+	c := mcp.NewClient(stdio.NewStream(stdinr, stdoutw), &client{})
+	s := mcp.NewServer(stdio.NewStream(stdoutr, stdinw), mux,
+		mcp.OnSessionStart(func(ctx context.Context, s *mcp.Session) { started <- s }),
+		mcp.OnSessionEnd(func(ctx context.Context, s *mcp.Session) { ended <- s }),
+	)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Listen(ctx) }()
+	go c.Listen(ctx)
+
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{
+		ProtocolVersion: "1.0.0",
+		ClientInfo:      mcp.ClientInfo{Name: "tester", Version: "1.0"},
+	})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+	sess := <-started
+	if sess.ID() == "" || sess.InitializeRequest().ClientInfo.Name != "tester" {
+		t.Fatalf("unexpected session: %s %+v", sess.ID(), sess.InitializeRequest())
+	}
+
+	for i := 1; i <= 2; i++ {
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "count"}))
+		if err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+		if want := fmt.Sprintf("tester call %d", i); resp.Result.Content[0].Text != want {
+			t.Fatalf("got %q, want %q", resp.Result.Content[0].Text, want)
+		}
+	}
+	if n, ok := calls.Get(sess); !ok || n != 2 {
+		t.Fatalf("expected 2 calls in the session, got %d", n)
+	}
+
+	stdoutw.CloseWithError(errors.New("closed"))
+	<-done
+	if end := <-ended; end != sess {
+		t.Fatalf("ended session %s, want %s", end.ID(), sess.ID())
+	}
+}
+
+// hub is an mcp.SessionStream that connects several clients to one server,
+// like the sse transport does.
+type hub struct {
+	in     chan *mcp.Message
+	opened chan string
+	closed chan string
+
+	mu    sync.Mutex
+	conns map[string]*hubConn
+}
+
+type hubConn struct {
+	id  string
+	hub *hub
+	out chan *mcp.Message
+	// headers are added to the metadata of every message, like the HTTP
+	// headers of an sse client.
+	headers map[string]string
+}
+
+func newHub() *hub {
+	return &hub{
+		in:     make(chan *mcp.Message),
+		opened: make(chan string),
+		closed: make(chan string),
+		conns:  map[string]*hubConn{},
+	}
+}
+
+// connect opens a session. The server must be listening.
+func (h *hub) connect(id string) *hubConn {
+	h.opened <- id
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := &hubConn{id: id, hub: h, out: make(chan *mcp.Message, 16)}
+	h.conns[id] = c
+	return c
+}
+
+func (h *hub) disconnect(id string) {
+	h.mu.Lock()
+	c := h.conns[id]
+	delete(h.conns, id)
+	h.mu.Unlock()
+	close(c.out)
+	h.closed <- id
+}
+
+func (h *hub) Recv() (*mcp.Message, error) {
+	return <-h.in, nil
+}
+
+func (h *hub) Send(msg *mcp.Message) error {
+	h.mu.Lock()
+	c, ok := h.conns[msg.Metadata["session_id"]]
+	h.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown session %q", msg.Metadata["session_id"])
+	}
+	c.out <- msg
+	return nil
+}
+
+func (h *hub) OpenedSessions() <-chan string {
+	return h.opened
+}
+
+func (h *hub) ClosedSessions() <-chan string {
+	return h.closed
+}
+
+func (c *hubConn) Recv() (*mcp.Message, error) {
+	msg, ok := <-c.out
+	if !ok {
+		return nil, io.EOF
+	}
+	return msg, nil
+}
+
+func (c *hubConn) Send(msg *mcp.Message) error {
+	m := *msg
+	m.Metadata = map[string]string{"session_id": c.id}
+	for k, v := range c.headers {
+		m.Metadata[k] = v
+	}
+	c.hub.in <- &m
+	return nil
+}
+
+func TestMultipleSessions(t *testing.T) {
+	ctx := context.Background()
+
+	h := newHub()
+	ended := make(chan *mcp.Session, 1)
+	s := mcp.NewServer(h, &server{},
+		mcp.OnSessionEnd(func(ctx context.Context, s *mcp.Session) { ended <- s }),
+	)
+	go s.Listen(ctx)
+
+	clients := map[string]*mcp.Client{}
+	changed := make(chan string, 2)
+	for _, id := range []string{"a", "b"} {
+		c := mcp.NewClient(h.connect(id), &client{})
+		go c.Listen(ctx)
+		mcp.HandleNotification(c, "notifications/tools/list_changed", func(ctx context.Context, req *mcp.Request[struct{}]) error {
+			changed <- id
+			return nil
+		})
+		if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{
+			ProtocolVersion: "1.0.0",
+			ClientInfo:      mcp.ClientInfo{Name: id},
+			Capabilities: mcp.ClientCapabilities{
+				Experimental: map[string]json.RawMessage{"x-" + id: json.RawMessage("{}")},
+			},
+		})); err != nil {
+			t.Fatalf("failed to initialize client %s: %v", id, err)
+		}
+		clients[id] = c
+	}
+
+	sessions := s.Sessions()
+	if len(sessions) != 2 || sessions[0].ID() != "a" || sessions[1].ID() != "b" {
+		t.Fatalf("unexpected sessions: %v", sessions)
+	}
+	for _, sess := range sessions {
+		caps := sess.ClientCapabilities()
+		if _, ok := caps.Experimental["x-"+sess.ID()]; !ok || len(caps.Experimental) != 1 {
+			t.Errorf("session %s has client capabilities %+v", sess.ID(), caps)
+		}
+	}
+	if caps := s.ClientCapabilities(); caps != nil {
+		t.Errorf("server with two sessions has client capabilities %+v", caps)
+	}
+
+	t.Run("ping", func(t *testing.T) {
+		if _, err := s.Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err == nil {
+			t.Fatal("expected an error pinging without choosing a session")
+		}
+		var wg sync.WaitGroup
+		for _, sess := range sessions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 5 {
+					if _, err := sess.Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+						t.Errorf("failed to ping session %s: %v", sess.ID(), err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("broadcast", func(t *testing.T) {
+		if err := s.ToolsListChanged(ctx); err != nil {
+			t.Fatalf("failed to broadcast: %v", err)
+		}
+		got := []string{<-changed, <-changed}
+		slices.Sort(got)
+		if !slices.Equal(got, []string{"a", "b"}) {
+			t.Fatalf("notification reached %v", got)
+		}
+	})
+
+	t.Run("targeted", func(t *testing.T) {
+		if err := sessions[1].ToolsListChanged(ctx); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+		if id := <-changed; id != "b" {
+			t.Fatalf("notification reached %s", id)
+		}
+	})
+
+	t.Run("end", func(t *testing.T) {
+		h.disconnect("a")
+		if sess := <-ended; sess.ID() != "a" {
+			t.Fatalf("ended session %s", sess.ID())
+		}
+		if sessions := s.Sessions(); len(sessions) != 1 || sessions[0].ID() != "b" {
+			t.Fatalf("unexpected sessions: %v", sessions)
+		}
+		if _, err := s.Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+			t.Fatalf("failed to ping the remaining session: %v", err)
+		}
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		// A connection the server never heard of, like a late message
+		// for a session that has ended.
+		stray := &hubConn{id: "a", hub: h, out: make(chan *mcp.Message, 1)}
+		h.mu.Lock()
+		h.conns["a"] = stray
+		h.mu.Unlock()
+		defer func() {
+			h.mu.Lock()
+			delete(h.conns, "a")
+			h.mu.Unlock()
+		}()
+
+		id, version, method := json.Number("1"), "2.0", string(mcp.MethodPing)
+		stray.Send(&mcp.Message{ID: &id, JsonRPC: &version, Method: &method})
+		select {
+		case resp := <-stray.out:
+			if resp.Error == nil || resp.Error.Code != mcp.CodeInvalidRequest {
+				t.Fatalf("expected an invalid request error, got %+v", resp)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no response")
+		}
+		if sessions := s.Sessions(); len(sessions) != 1 || sessions[0].ID() != "b" {
+			t.Fatalf("unexpected sessions: %v", sessions)
+		}
+	})
+}
+
+func TestConcurrencyLimits(t *testing.T) {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		<-release
+		return mcp.NewResponse(&mcp.CallToolResponse{}), nil
+	})
+
+	c, s := connect(t, mux,
+		mcp.WithMaxConcurrentRequests(1),
+		mcp.WithRequestQueueSize(1),
+		mcp.WithOverloadedError(),
+	)
+
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool {
+		stats := s.QueueStats()
+		return stats.InFlight == 1 && stats.Queued == 1
+	})
+
+	_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeOverloaded {
+		t.Fatalf("expected overloaded error, got %v", err)
+	}
+	if stats := s.QueueStats(); stats.Rejected != 1 {
+		t.Fatalf("expected one rejected request, got %+v", stats)
+	}
+
+	close(release)
+	for range 2 {
+		if err := <-errs; err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		stats := s.QueueStats()
+		return stats.InFlight == 0 && stats.Queued == 0
+	})
+}
+
+func TestConcurrencyLimitsCallPeer(t *testing.T) {
+	ctx := context.Background()
+
+	started, rejected := make(chan struct{}), make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		if req.Params.Name == "ping" {
+			close(started)
+			<-rejected
+			if _, err := mcp.SessionFromContext(ctx).Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+				return nil, err
+			}
+		}
+		return mcp.NewResponse(&mcp.CallToolResponse{}), nil
+	})
+
+	c, s := connect(t, mux, mcp.WithMaxConcurrentRequests(1), mcp.WithOverloadedError())
+	// The initialize call holds its slot until after its response is sent.
+	waitFor(t, func() bool { return s.QueueStats().InFlight == 0 })
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "ping"}))
+		errs <- err
+	}()
+	select {
+	case <-started:
+	case err := <-errs:
+		t.Fatalf("call finished before its handler started: %v", err)
+	}
+
+	// The server is at its limit, but it still reads the client's response
+	// to the handler's ping.
+	_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "other"}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeOverloaded {
+		t.Fatalf("expected overloaded error, got %v", err)
+	}
+	close(rejected)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler waiting on the client never finished")
+	}
+}
+
+func TestConcurrencyLimitsBackpressure(t *testing.T) {
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		<-release
+		return mcp.NewResponse(&mcp.CallToolResponse{}), nil
+	})
+	var notified atomic.Int32
+	mcp.HandleNotification(mux, "x-test/sequence", func(ctx context.Context, req *mcp.Request[sequenceNotification]) error {
+		notified.Add(1)
+		return nil
+	})
+
+	c, s := connect(t, mux, mcp.WithMaxConcurrentRequests(1), mcp.WithRequestQueueSize(1))
+	waitFor(t, func() bool { return s.QueueStats().InFlight == 0 })
+
+	errs := make(chan error, 3)
+	for range 2 {
+		go func() {
+			_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+			errs <- err
+		}()
+	}
+	waitFor(t, func() bool {
+		stats := s.QueueStats()
+		return stats.InFlight == 1 && stats.Queued == 1
+	})
+
+	// Neither requests nor notifications get past a full queue: the server
+	// stops reading until there is room.
+	go func() {
+		errs <- mcp.Notify(ctx, c, "x-test/sequence", mcp.NewRequest(&sequenceNotification{N: 1}))
+	}()
+	go func() {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+		errs <- err
+	}()
+	waitFor(t, func() bool { return s.QueueStats().Blocked })
+	if stats := s.QueueStats(); stats.Queued != 1 || stats.Rejected != 0 || notified.Load() != 0 {
+		t.Fatalf("unexpected stats while blocked: %+v", stats)
+	}
+
+	close(release)
+	for range 4 {
+		if err := <-errs; err != nil {
+			t.Fatalf("failed to call tool: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		stats := s.QueueStats()
+		return stats.InFlight == 0 && stats.Queued == 0 && !stats.Blocked && notified.Load() == 1
+	})
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type sequenceNotification struct {
+	N int `json:"n"`
+}
+
+func TestSequentialProcessing(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var got []int
+	var active, overlapped atomic.Int32
+	// record notes that message n was handled and whether another message
+	// was being handled at the same time.
+	record := func(n int) {
+		if active.Add(1) > 1 {
+			overlapped.Add(1)
+		}
+		defer active.Add(-1)
+		mu.Lock()
+		got = append(got, n)
+		mu.Unlock()
+	}
+	mux := mcp.NewMux()
+	mcp.HandleNotification(mux, "x-test/sequence", func(ctx context.Context, req *mcp.Request[sequenceNotification]) error {
+		record(req.Params.N)
+		return nil
+	})
+	mcp.Handle(mux, mcp.MethodPing, func(ctx context.Context, req *mcp.Request[mcp.PingRequest]) (*mcp.Response[mcp.PingResponse], error) {
+		record(-1)
+		return mcp.NewResponse(&mcp.PingResponse{}), nil
+	})
+
+	c, _ := connect(t, mux, mcp.WithSequentialProcessing())
+	for n := range 10 {
+		if err := mcp.Notify(ctx, c, "x-test/sequence", mcp.NewRequest(&sequenceNotification{N: n})); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	if _, err := c.Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, -1}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if n := overlapped.Load(); n != 0 {
+		t.Fatalf("%d messages were handled concurrently", n)
+	}
+}
+
+func TestOrderedNotifications(t *testing.T) {
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var mu sync.Mutex
+	var got []int
+	var active, overlapped atomic.Int32
+	mux := mcp.NewMux()
+	mcp.HandleNotification(mux, "x-test/sequence", func(ctx context.Context, req *mcp.Request[sequenceNotification]) error {
+		if active.Add(1) > 1 {
+			overlapped.Add(1)
+		}
+		defer active.Add(-1)
+		mu.Lock()
+		got = append(got, req.Params.N)
+		mu.Unlock()
+		if req.Params.N == 9 {
+			close(release)
+		}
+		return nil
+	})
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		// The notifications sent after this request must not wait for it.
+		close(started)
+		<-release
+		return mcp.NewResponse(&mcp.CallToolResponse{}), nil
+	})
+
+	c, _ := connect(t, mux, mcp.WithOrderedNotifications())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+		errs <- err
+	}()
+	select {
+	case <-started:
+	case err := <-errs:
+		t.Fatalf("call finished before its handler started: %v", err)
+	}
+	for n := range 10 {
+		if err := mcp.Notify(ctx, c, "x-test/sequence", mcp.NewRequest(&sequenceNotification{N: n})); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if n := overlapped.Load(); n != 0 {
+		t.Fatalf("%d notifications were handled concurrently", n)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	cancelled := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	})
+
+	c, _ := connectClient(t, mux, []mcp.ClientOption{
+		mcp.WithCallTimeout(time.Second),
+		mcp.WithMethodCallTimeout(mcp.MethodCallTool, 10*time.Millisecond),
+	})
+
+	_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeRequestTimeout {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("handler was not cancelled")
+	}
+
+	if _, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{})); err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("no deadline")
+		}
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	c, _ := connect(t, mux,
+		mcp.WithHandlerTimeout(time.Second),
+		mcp.WithMethodHandlerTimeout(mcp.MethodCallTool, 10*time.Millisecond),
+	)
+
+	if _, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{})); err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeRequestTimeout {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "boom"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		panic("boom")
+	})
+
+	for _, tc := range []struct {
+		name string
+		opts func(h mcp.PanicHandler) []mcp.ServerOption
+	}{
+		{"handler", func(h mcp.PanicHandler) []mcp.ServerOption {
+			return []mcp.ServerOption{mcp.WithPanicHandler(h)}
+		}},
+		{"interceptor", func(h mcp.PanicHandler) []mcp.ServerOption {
+			return []mcp.ServerOption{
+				mcp.WithInterceptors(mcp.RecoverInterceptor(h)),
+				mcp.WithPanicHandler(func(context.Context, string, any, []byte) {
+					t.Error("panic escaped the interceptor")
+				}),
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			panics := make(chan string, 1)
+			c, _ := connect(t, mux, tc.opts(func(ctx context.Context, method string, v any, stack []byte) {
+				if len(stack) == 0 {
+					t.Error("expected a stack trace")
+				}
+				panics <- fmt.Sprintf("%s: %v", method, v)
+			})...)
+
+			_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "boom"}))
+			var rpcErr *mcp.Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInternalError {
+				t.Fatalf("expected internal error, got %v", err)
+			}
+			if got, want := <-panics, "tools/call: boom"; got != want {
+				t.Fatalf("got panic %q, want %q", got, want)
+			}
+
+			if _, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{})); err != nil {
+				t.Fatalf("failed to list tools after panic: %v", err)
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		close(started)
+		select {
+		case <-release:
+			return mcp.NewResponse(&mcp.CallToolResponse{}), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+
+	stdinr, stdinw := io.Pipe()
+	stdoutr, stdoutw := io.Pipe()
+	c := mcp.NewClient(stdio.NewStream(stdinr, stdoutw), &client{})
+	s := mcp.NewServer(stdio.NewStream(stdoutr, stdinw), mux)
+
+	listening := make(chan error, 1)
+	go func() { listening <- s.Listen(ctx) }()
+	go c.Listen(ctx)
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+		called <- err
+	}()
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+
+	waitFor(t, func() bool {
+		_, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		var rpcErr *mcp.Error
+		return errors.As(err, &rpcErr) && rpcErr.Code() == mcp.CodeConnectionClosed
+	})
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned before the handler finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-called; err != nil {
+		t.Fatalf("in-flight call failed: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+	if err := <-listening; err != nil {
+		t.Fatalf("expected listen to return nil after shutdown, got %v", err)
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	c, s := connect(t, mux)
+	go c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+	<-started
+
+	sctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(sctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestCloseIdle(t *testing.T) {
+	stdinr, _ := io.Pipe()
+	_, stdoutw := io.Pipe()
+	s := mcp.NewServer(stdio.NewStream(stdinr, stdoutw), mcp.NewMux())
+	listening := make(chan error, 1)
+	go func() { listening <- s.Listen(context.Background()) }()
+
+	for range 100 {
+		if err := s.Close(); err != nil {
+			t.Fatalf("failed to close idle server: %v", err)
+		}
+	}
+	if err := <-listening; err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+}
+
+// closeRecorder is a pipe end that records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	io.Writer
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestStdioClose(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []stdio.Option
+		want bool
+	}{
+		{name: "default"},
+		{name: "underlying", opts: []stdio.Option{stdio.WithCloseUnderlying()}, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pr, _ := io.Pipe()
+			r, w := &closeRecorder{Reader: pr}, &closeRecorder{Writer: io.Discard}
+			s := mcp.NewServer(stdio.NewStream(r, w, tc.opts...), mcp.NewMux())
+			listening := make(chan error, 1)
+			go func() { listening <- s.Listen(context.Background()) }()
+
+			if err := s.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+			select {
+			case err := <-listening:
+				if err != nil {
+					t.Fatalf("listen failed: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("listen didn't return after close")
+			}
+			if r.closed.Load() != tc.want || w.closed.Load() != tc.want {
+				t.Fatalf("reader closed %v, writer closed %v, want %v", r.closed.Load(), w.closed.Load(), tc.want)
+			}
+		})
+	}
+}
+
+// blockingStream is a stream without a Close method whose Recv never
+// returns.
+type blockingStream struct{}
+
+func (blockingStream) Recv() (*mcp.Message, error) {
+	select {}
+}
+
+func (blockingStream) Send(msg *mcp.Message) error {
+	return nil
+}
+
+func TestShutdownUnclosableStream(t *testing.T) {
+	s := mcp.NewServer(blockingStream{}, mcp.NewMux())
+	listening := make(chan error, 1)
+	go func() { listening <- s.Listen(context.Background()) }()
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+	select {
+	case err := <-listening:
+		if err != nil {
+			t.Fatalf("listen failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listen didn't return after shutdown")
+	}
+}
+
+func TestListenContext(t *testing.T) {
+	stdinr, _ := io.Pipe()
+	_, stdoutw := io.Pipe()
+	s := mcp.NewServer(stdio.NewStream(stdinr, stdoutw), mcp.NewMux())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listening := make(chan error, 1)
+	go func() { listening <- s.Listen(ctx) }()
+	cancel()
+
+	select {
+	case err := <-listening:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listen didn't return after its context was cancelled")
+	}
+}
+
+func TestConnectionClosed(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	mux := mcp.NewMux()
+	mcp.Handle(mux, mcp.MethodListTools, func(ctx context.Context, req *mcp.Request[mcp.ListToolsRequest]) (*mcp.Response[mcp.ListToolsResponse], error) {
+		return mcp.NewResponse(&mcp.ListToolsResponse{Tools: []mcp.Tool{{Name: "wait"}}}), nil
+	})
+	mcp.Handle(mux, mcp.MethodCallTool, func(ctx context.Context, req *mcp.Request[mcp.CallToolRequest]) (*mcp.Response[mcp.CallToolResponse], error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	stdinr, stdinw := io.Pipe()
+	stdoutr, stdoutw := io.Pipe()
+	c := mcp.NewClient(stdio.NewStream(stdinr, stdoutw), &client{})
+	s := mcp.NewServer(stdio.NewStream(stdoutr, stdinw), mux)
+
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.Listen(sctx)
+	listening := make(chan error, 1)
+	go func() { listening <- c.Listen(ctx) }()
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected no error while connected, got %v", err)
+	}
+
+	called := make(chan error, 1)
+	go func() {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "wait"}))
+		called <- err
+	}()
+	<-started
+
+	broken := errors.New("broken pipe")
+	stdinw.CloseWithError(broken)
+	if err := <-listening; !errors.Is(err, broken) {
+		t.Fatalf("expected listen to fail with %v, got %v", broken, err)
+	}
+
+	for _, err := range []error{
+		<-called,
+		func() error {
+			_, err := c.ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+			return err
+		}(),
+	} {
+		var rpcErr *mcp.Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeConnectionClosed {
+			t.Fatalf("expected connection closed error, got %v", err)
+		}
+		if !errors.Is(err, mcp.ErrConnectionClosed) || !errors.Is(err, broken) {
+			t.Fatalf("expected error to wrap the cause, got %v", err)
+		}
+	}
+	if err := c.Err(); !errors.Is(err, broken) {
+		t.Fatalf("expected terminal error %v, got %v", broken, err)
+	}
+}
+
+func TestListenEOF(t *testing.T) {
+	in := strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}` + "\n")
+	s := mcp.NewServer(stdio.NewStream(in, io.Discard), mcp.NewMux())
+
+	listening := make(chan error, 1)
+	go func() { listening <- s.Listen(context.Background()) }()
+	select {
+	case err := <-listening:
+		if err != nil {
+			t.Fatalf("expected listen to return nil at EOF, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listen didn't return at EOF")
+	}
+	if err := s.Err(); !errors.Is(err, mcp.ErrConnectionClosed) {
+		t.Fatalf("expected connection closed, got %v", err)
+	}
+}
+
+func TestToolErrorResults(t *testing.T) {
+	ctx := context.Background()
+
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "fail"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "", errors.New("disk full")
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "domain"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "", mcp.NewError(mcp.CodeInvalidParams, errors.New("no such city"))
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "reject"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "", mcp.ProtocolError(mcp.NewError(mcp.CodeInvalidParams, errors.New("bad input")))
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "image"}, func(ctx context.Context, args struct{}) (*mcp.CallToolResponse, error) {
+		return mcp.ImageResult([]byte("png"), "image/png"), nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "json"}, func(ctx context.Context, args struct{}) (*mcp.CallToolResponse, error) {
+		return mcp.JSONResult(map[string]int{"n": 1})
+	})
+
+	c, _ := connect(t, &server{}, mcp.WithToolRegistry(tools), mcp.WithToolErrorResults())
+	call := func(name string) (*mcp.CallToolResponse, error) {
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: name}))
+		if err != nil {
+			return nil, err
+		}
+		return resp.Result, nil
+	}
+
+	result, err := call("fail")
+	if err != nil {
+		t.Fatalf("expected an error result, got %v", err)
+	}
+	if !result.IsError || len(result.Content) != 1 || result.Content[0].Text != "disk full" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// An *Error is a tool failure unless it is marked as a protocol error.
+	result, err = call("domain")
+	if err != nil {
+		t.Fatalf("expected an error result, got %v", err)
+	}
+	if !result.IsError || result.Content[0].Text != "no such city" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	for _, name := range []string{"reject", "missing"} {
+		var rpcErr *mcp.Error
+		if _, err := call(name); !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+			t.Fatalf("%s: expected invalid params error, got %v", name, err)
+		}
+	}
+
+	result, err = call("image")
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	if c := result.Content[0]; c.Type != "image" || c.MimeType != "image/png" || c.Data != "cG5n" {
+		t.Fatalf("unexpected image content: %+v", c)
+	}
+
+	result, err = call("json")
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	if result.Content[0].Text != `{"n":1}` || string(result.StructuredContent) != `{"n":1}` {
+		t.Fatalf("unexpected JSON result: %+v", result)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	ctx := context.Background()
+
+	m := tasks.New()
+	tools, resources := mcp.NewToolRegistry(), mcp.NewResourceRegistry()
+	m.Register(tools, resources)
+	release := make(chan struct{})
+	tasks.AddTool(m, tools, mcp.Tool{Name: "export"}, func(ctx context.Context, h *tasks.Handle, args struct{}) (*mcp.CallToolResponse, error) {
+		<-release
+		return mcp.TextResult("exported"), nil
+	})
+
+	c, _ := connect(t, &server{}, mcp.WithToolRegistry(tools), mcp.WithResourceRegistry(resources))
+	updated := make(chan string, 1)
+	mcp.HandleNotification(c, mcp.MethodResourceUpdated, func(ctx context.Context, req *mcp.Request[mcp.ResourceUpdatedNotification]) error {
+		updated <- req.Params.URI
+		return nil
+	})
+
+	resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "export"}))
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	var ticket tasks.Ticket
+	if err := json.Unmarshal(resp.Result.StructuredContent, &ticket); err != nil {
+		t.Fatalf("failed to decode ticket: %v", err)
+	}
+
+	close(release)
+	if uri := <-updated; uri != ticket.URI {
+		t.Fatalf("got update for %s, want %s", uri, ticket.URI)
+	}
+	read, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: ticket.URI}))
+	if err != nil {
+		t.Fatalf("failed to read task: %v", err)
+	}
+	var task tasks.Task
+	if err := json.Unmarshal([]byte(read.Result.Contents[0].Text), &task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	if task.Status != tasks.Completed || task.Result.Content[0].Text != "exported" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
+
+func TestTaskAfterSessionEnds(t *testing.T) {
+	ctx := context.Background()
+
+	m := tasks.New(tasks.WithOwner(func(ctx context.Context) string { return "tester" }))
+	tools, resources := mcp.NewToolRegistry(), mcp.NewResourceRegistry()
+	m.Register(tools, resources)
+	release, outputErr := make(chan struct{}), make(chan error, 1)
+	tasks.AddTool(m, tools, mcp.Tool{Name: "export"}, func(ctx context.Context, h *tasks.Handle, args struct{}) (*mcp.CallToolResponse, error) {
+		<-release
+		outputErr <- h.Output(ctx, mcp.Content{Type: "text", Text: "partial"})
+		return mcp.TextResult("exported"), nil
+	})
+
+	h := newHub()
+	s := mcp.NewServer(h, &server{}, mcp.WithToolRegistry(tools), mcp.WithResourceRegistry(resources))
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.Listen(sctx)
+
+	c := mcp.NewClient(h.connect("a"), &client{})
+	go c.Listen(sctx)
+	if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+		t.Fatalf("failed to initialize client: %v", err)
+	}
+	resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "export"}))
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	var ticket tasks.Ticket
+	if err := json.Unmarshal(resp.Result.StructuredContent, &ticket); err != nil {
+		t.Fatalf("failed to decode ticket: %v", err)
+	}
+
+	// The client is gone before the task reports anything.
+	h.disconnect("a")
+	close(release)
+	if err := <-outputErr; err != nil {
+		t.Fatalf("output failed after the session ended: %v", err)
+	}
+	var task *tasks.Task
+	waitFor(t, func() bool {
+		task, err = m.Get(ctx, ticket.TaskID)
+		return err != nil || task.Status != tasks.Working
+	})
+	if err != nil {
+		t.Fatalf("failed to get task: %v", err)
+	}
+	if task.Status != tasks.Completed || task.Result.Content[0].Text != "exported" || task.Output[0].Text != "partial" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
+
+type deleteArgs struct {
+	Path    string `json:"path"`
+	Confirm bool   `json:"confirm"`
+}
+
+func TestRegistryMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var trace []string
+	record := func(name string) mcp.Middleware {
+		return func(next mcp.InvokeFunc) mcp.InvokeFunc {
+			return func(ctx context.Context, inv *mcp.Invocation) (any, error) {
+				mu.Lock()
+				trace = append(trace, fmt.Sprintf("%s %s %s", name, inv.Kind, inv.Name))
+				mu.Unlock()
+				return next(ctx, inv)
+			}
+		}
+	}
+	confirm := func(next mcp.InvokeFunc) mcp.InvokeFunc {
+		return func(ctx context.Context, inv *mcp.Invocation) (any, error) {
+			if args, ok := inv.Args.(deleteArgs); !ok || !args.Confirm {
+				return mcp.ErrorResult(errors.New("confirmation required")), nil
+			}
+			return next(ctx, inv)
+		}
+	}
+
+	tools := mcp.NewToolRegistry()
+	tools.Use(record("all"))
+	tools.UseTag("destructive", confirm, record("tag"))
+	mcp.AddTool(tools, mcp.Tool{Name: "delete"}, func(ctx context.Context, args deleteArgs) (string, error) {
+		return "deleted " + args.Path, nil
+	}, mcp.WithTags("destructive"), mcp.WithMiddleware(record("own")))
+	mcp.AddTool(tools, mcp.Tool{Name: "list"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "a b c", nil
+	})
+
+	prompts := mcp.NewPromptRegistry()
+	prompts.AddPrompt(mcp.Prompt{Name: "greet"}, mcp.PromptFunc(func(ctx context.Context, args map[string]string) ([]mcp.PromptMessage, error) {
+		return []mcp.PromptMessage{mcp.TextMessage("user", "hello "+args["name"])}, nil
+	}), mcp.WithMiddleware(func(next mcp.InvokeFunc) mcp.InvokeFunc {
+		return func(ctx context.Context, inv *mcp.Invocation) (any, error) {
+			args := inv.Args.(map[string]string)
+			if args["name"] == "" {
+				return []mcp.PromptMessage{mcp.TextMessage("user", "hello stranger")}, nil
+			}
+			return next(ctx, inv)
+		}
+	}))
+
+	resources := mcp.NewResourceRegistry()
+	resources.UseTag("users", record("tag"))
+	resources.AddResourceTemplate(mcp.ResourceTemplate{URITemplate: "user://{id}", Name: "user"},
+		func(ctx context.Context, uri string, vars map[string]string) ([]mcp.ResourceContent, error) {
+			return []mcp.ResourceContent{{URI: uri, Text: "user " + vars["id"]}}, nil
+		}, mcp.WithTags("users"), mcp.WithMiddleware(func(next mcp.InvokeFunc) mcp.InvokeFunc {
+			return func(ctx context.Context, inv *mcp.Invocation) (any, error) {
+				if inv.Args.(map[string]string)["id"] == "root" {
+					return nil, mcp.NewError(mcp.CodeInvalidParams, errors.New("forbidden"))
+				}
+				return next(ctx, inv)
+			}
+		}))
+
+	c, _ := connect(t, &server{},
+		mcp.WithToolRegistry(tools),
+		mcp.WithPromptRegistry(prompts),
+		mcp.WithResourceRegistry(resources),
+	)
+	callTool := func(name string, args any) *mcp.CallToolResponse {
+		t.Helper()
+		raw, _ := json.Marshal(args)
+		resp, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: name, Arguments: raw}))
+		if err != nil {
+			t.Fatalf("failed to call %s: %v", name, err)
+		}
+		return resp.Result
+	}
+
+	if result := callTool("delete", deleteArgs{Path: "/tmp"}); !result.IsError || result.Content[0].Text != "confirmation required" {
+		t.Fatalf("expected confirmation error, got %+v", result)
+	}
+	if result := callTool("delete", deleteArgs{Path: "/tmp", Confirm: true}); result.Content[0].Text != "deleted /tmp" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if result := callTool("list", struct{}{}); result.Content[0].Text != "a b c" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	resp, err := c.GetPrompt(ctx, mcp.NewRequest(&mcp.GetPromptRequest{Name: "greet"}))
+	if err != nil {
+		t.Fatalf("failed to get prompt: %v", err)
+	}
+	if text := resp.Result.Messages[0].Content.Text; text != "hello stranger" {
+		t.Fatalf("unexpected prompt: %s", text)
+	}
+
+	read, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: "user://42"}))
+	if err != nil {
+		t.Fatalf("failed to read resource: %v", err)
+	}
+	if text := read.Result.Contents[0].Text; text != "user 42" {
+		t.Fatalf("unexpected resource: %s", text)
+	}
+	var rpcErr *mcp.Error
+	if _, err := c.ReadResource(ctx, mcp.NewRequest(&mcp.ReadResourceRequest{URI: "user://root"})); !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{
+		"all tool delete",
+		"all tool delete", "tag tool delete", "own tool delete",
+		"all tool list",
+		"tag resource user://{id}",
+		"tag resource user://{id}",
+	}
+	if !slices.Equal(trace, want) {
+		t.Fatalf("got trace %q, want %q", trace, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var notified int
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "export"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "exported", nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "echo"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "echo", nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "log"}, func(ctx context.Context, args struct{}) (string, error) {
+		for range 3 {
+			if err := mcp.SessionFromContext(ctx).LogMessage(ctx, mcp.NewRequest(&mcp.LogMessageRequest{Level: mcp.LevelInfo})); err != nil {
+				return "", err
+			}
+		}
+		return "logged", nil
+	})
+	mux := mcp.NewMux()
+	mcp.HandleNotification(mux, "x-test/sequence", func(ctx context.Context, req *mcp.Request[sequenceNotification]) error {
+		mu.Lock()
+		notified++
+		mu.Unlock()
+		return nil
+	})
+
+	var logged atomic.Int32
+	countLogs := mcp.UnaryInterceptorFunc(func(next mcp.UnaryFunc) mcp.UnaryFunc {
+		return func(ctx context.Context, req mcp.AnyRequest) (mcp.AnyResponse, error) {
+			if req.Method() == "notifications/message" {
+				logged.Add(1)
+			}
+			return next(ctx, req)
+		}
+	})
+
+	limiter := ratelimit.New(
+		ratelimit.WithRequestLimit(ratelimit.PerMinute(1, 1), ratelimit.Join(ratelimit.BySession(), ratelimit.ByTool("export"))),
+		ratelimit.WithNotificationLimit(ratelimit.PerMinute(1, 2), ratelimit.BySession()),
+	)
+	c, _ := connectClient(t, mux, []mcp.ClientOption{mcp.WithInterceptors(countLogs)}, mcp.WithToolRegistry(tools), mcp.WithInterceptors(limiter))
+
+	call := func(name string) error {
+		_, err := c.CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: name}))
+		return err
+	}
+	if err := call("export"); err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	err := call("export")
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != ratelimit.CodeRateLimited {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+	if wait, ok := ratelimit.RetryAfter(err); !ok || wait <= 0 || wait > time.Minute {
+		t.Fatalf("unexpected retry-after %v, %v", wait, ok)
+	}
+	for range 3 {
+		if err := call("echo"); err != nil {
+			t.Fatalf("expected other tools to be unlimited, got %v", err)
+		}
+	}
+
+	for n := range 3 {
+		if err := mcp.Notify(ctx, c, "x-test/sequence", mcp.NewRequest(&sequenceNotification{N: n})); err != nil {
+			t.Fatalf("failed to notify: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return notified == 2
+	})
+
+	// The server's own notifications aren't limited.
+	if err := call("log"); err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	waitFor(t, func() bool { return logged.Load() == 3 })
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+
+	tools := mcp.NewToolRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "whoami"}, func(ctx context.Context, args struct{}) (string, error) {
+		p, _ := auth.FromContext(ctx)
+		return p.Subject, nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "delete"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "deleted", nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "rebuild"}, func(ctx context.Context, args struct{}) (string, error) {
+		// Requests the server sends carry no token and must get through.
+		resp, err := mcp.Call[rebuildRequest, rebuildResponse](ctx, mcp.SessionFromContext(ctx), "x-acme/index/rebuild", mcp.NewRequest(&rebuildRequest{Index: "docs"}))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprint(resp.Result.Documents), nil
+	})
+
+	authn := auth.New(auth.StaticTokens(map[string]*auth.Principal{
+		"reader-token": {Subject: "reader"},
+		"admin-token":  {Subject: "admin", Scopes: []string{"admin"}},
+	}), auth.WithToolScopes("delete", "admin"), auth.WithPromptScopes("review", "admin"))
+
+	h := newHub()
+	s := mcp.NewServer(h, &server{}, mcp.WithToolRegistry(tools), mcp.WithInterceptors(authn))
+	go s.Listen(ctx)
+
+	clients := map[string]*mcp.Client{}
+	for id, token := range map[string]string{"anonymous": "", "reader": "reader-token", "admin": "admin-token"} {
+		conn := h.connect(id)
+		if token != "" {
+			conn.headers = map[string]string{"Authorization": "Bearer " + token}
+		}
+		c := mcp.NewClient(conn, &client{})
+		mcp.Handle(c, "x-acme/index/rebuild", func(ctx context.Context, req *mcp.Request[rebuildRequest]) (*mcp.Response[rebuildResponse], error) {
+			return mcp.NewResponse(&rebuildResponse{Documents: 3}), nil
+		})
+		go c.Listen(ctx)
+		clients[id] = c
+	}
+
+	var rpcErr *mcp.Error
+	_, err := clients["anonymous"].Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"}))
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != auth.CodeUnauthorized {
+		t.Fatalf("anonymous initialize: got %v, want code %d", err, auth.CodeUnauthorized)
+	}
+	if _, err := clients["anonymous"].Ping(ctx, mcp.NewRequest(&mcp.PingRequest{})); err != nil {
+		t.Errorf("anonymous ping: %v", err)
+	}
+
+	for _, id := range []string{"reader", "admin"} {
+		if _, err := clients[id].Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+			t.Fatalf("failed to initialize %s: %v", id, err)
+		}
+	}
+
+	list := func(id string) []string {
+		resp, err := clients[id].ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list tools for %s: %v", id, err)
+		}
+		var names []string
+		for _, tool := range resp.Result.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+	if names := list("reader"); !slices.Equal(names, []string{"whoami", "rebuild"}) {
+		t.Errorf("reader tools = %v, want [whoami rebuild]", names)
+	}
+	if names := list("admin"); !slices.Equal(names, []string{"whoami", "delete", "rebuild"}) {
+		t.Errorf("admin tools = %v, want [whoami delete rebuild]", names)
+	}
+
+	resp, err := clients["reader"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "whoami"}))
+	if err != nil {
+		t.Fatalf("failed to call whoami: %v", err)
+	}
+	if got := resp.Result.Content[0].Text; got != "reader" {
+		t.Errorf("whoami = %q, want reader", got)
+	}
+
+	_, err = clients["reader"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "delete"}))
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != auth.CodeForbidden {
+		t.Errorf("reader delete: got %v, want code %d", err, auth.CodeForbidden)
+	}
+	if _, err := clients["admin"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "delete"})); err != nil {
+		t.Errorf("admin delete: %v", err)
+	}
+
+	resp, err = clients["reader"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "rebuild"}))
+	if err != nil {
+		t.Fatalf("failed to call rebuild: %v", err)
+	}
+	if got := resp.Result.Content[0].Text; got != "3" {
+		t.Errorf("rebuild = %q, want 3", got)
+	}
+
+	complete := func(id string) error {
+		_, err := clients[id].Completion(ctx, mcp.NewRequest(&mcp.CompletionRequest{
+			Ref:      mcp.CompletionRef{Type: "ref/prompt", Name: "review"},
+			Argument: mcp.CompletionArgument{Name: "file", Value: "a"},
+		}))
+		return err
+	}
+	if err := complete("reader"); !errors.As(err, &rpcErr) || rpcErr.Code() != auth.CodeForbidden {
+		t.Errorf("reader completion: got %v, want code %d", err, auth.CodeForbidden)
+	}
+	// The handler doesn't implement completions, but the request gets past
+	// the authenticator.
+	if err := complete("admin"); errors.As(err, &rpcErr) && rpcErr.Code() == auth.CodeForbidden {
+		t.Errorf("admin completion: %v", err)
+	}
+}
+
+func TestDynamicVisibility(t *testing.T) {
+	ctx := context.Background()
+
+	tools := mcp.NewToolRegistry()
+	prompts := mcp.NewPromptRegistry()
+	mcp.AddTool(tools, mcp.Tool{Name: "echo"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "echo", nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "login"}, func(ctx context.Context, args struct{}) (string, error) {
+		tools.EnableToolFor(mcp.SessionFromContext(ctx), "admin")
+		return "welcome", nil
+	})
+	mcp.AddTool(tools, mcp.Tool{Name: "admin"}, func(ctx context.Context, args struct{}) (string, error) {
+		return "admin", nil
+	}, mcp.WithDisabled())
+
+	h := newHub()
+	s := mcp.NewServer(h, &server{},
+		mcp.WithToolRegistry(tools),
+		mcp.WithPromptRegistry(prompts),
+		mcp.WithListChangedDebounce(20*time.Millisecond),
+	)
+	listenCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() { defer wg.Done(); s.Listen(listenCtx) }()
+
+	clients := map[string]*mcp.Client{}
+	notified := map[string]chan string{}
+	for _, id := range []string{"a", "b"} {
+		// Ordered notifications arrive in the order they were sent, so a
+		// notification that shouldn't have been sent shows up before the
+		// expected ones.
+		c := mcp.NewClient(h.connect(id), &client{}, mcp.WithOrderedNotifications())
+		wg.Add(1)
+		go func() { defer wg.Done(); c.Listen(listenCtx) }()
+		notified[id] = make(chan string, 16)
+		for _, list := range []string{"tools", "prompts"} {
+			mcp.HandleNotification(c, mcp.Method("notifications/"+list+"/list_changed"), func(ctx context.Context, req *mcp.Request[struct{}]) error {
+				notified[id] <- list
+				return nil
+			})
+		}
+		if _, err := c.Initialize(ctx, mcp.NewRequest(&mcp.InitializeRequest{ProtocolVersion: "1.0.0"})); err != nil {
+			t.Fatalf("failed to initialize client %s: %v", id, err)
+		}
+		clients[id] = c
+	}
+	if caps := clients["a"].ServerCapabilities().Tools; caps == nil || !caps.ListChanged {
+		t.Errorf("tools capability = %+v, want listChanged", caps)
+	}
+
+	list := func(id string) []string {
+		resp, err := clients[id].ListTools(ctx, mcp.NewRequest(&mcp.ListToolsRequest{}))
+		if err != nil {
+			t.Fatalf("failed to list tools for %s: %v", id, err)
+		}
+		var names []string
+		for _, tool := range resp.Result.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+	// next waits for the next n notifications sent to a session and returns
+	// the lists they were about, sorted.
+	next := func(id string, n int) []string {
+		t.Helper()
+		var lists []string
+		timeout := time.After(5 * time.Second)
+		for range n {
+			select {
+			case list := <-notified[id]:
+				lists = append(lists, list)
+			case <-timeout:
+				t.Fatalf("timed out waiting for notifications for %s, got %v", id, lists)
+			}
+		}
+		return slices.Sorted(slices.Values(lists))
+	}
+
+	if names := list("a"); !slices.Equal(names, []string{"echo", "login"}) {
+		t.Errorf("tools before login = %v, want [echo login]", names)
+	}
+	if _, err := clients["a"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "admin"})); err == nil {
+		t.Errorf("disabled tool call succeeded")
+	}
+
+	if _, err := clients["a"].CallTool(ctx, mcp.NewRequest(&mcp.CallToolRequest{Name: "login"})); err != nil {
+		t.Fatalf("failed to log in: %v", err)
+	}
+	// Session b's notifications are checked by the ones that follow.
+	if got := next("a", 1); !slices.Equal(got, []string{"tools"}) {
+		t.Errorf("notifications after login = %v, want tools", got)
+	}
+	if names := list("a"); !slices.Equal(names, []string{"echo", "login", "admin"}) {
+		t.Errorf("tools after login = %v, want [echo login admin]", names)
+	}
+	if names := list("b"); !slices.Equal(names, []string{"echo", "login"}) {
+		t.Errorf("tools for other session = %v, want [echo login]", names)
+	}
+
+	// A burst of changes is announced once per session and list.
+	tools.DisableTool("echo")
+	tools.RemoveTool("login")
+	prompts.AddPrompt(mcp.Prompt{Name: "greet"}, mcp.PromptFunc(func(ctx context.Context, args map[string]string) ([]mcp.PromptMessage, error) {
+		return nil, nil
+	}))
+	for _, id := range []string{"a", "b"} {
+		if got := next(id, 2); !slices.Equal(got, []string{"prompts", "tools"}) {
+			t.Errorf("notifications for %s after burst = %v, want one for prompts and tools", id, got)
+		}
+	}
+	if names := list("a"); !slices.Equal(names, []string{"admin"}) {
+		t.Errorf("tools after burst = %v, want [admin]", names)
+	}
+
+	// Changes nobody can see aren't announced: the next notification each
+	// session gets is about a later change it can see.
+	tools.DisableToolFor(s.Sessions()[1], "admin")
+	prompts.RemovePrompt("greet")
+	for _, id := range []string{"a", "b"} {
+		if got := next(id, 1); !slices.Equal(got, []string{"prompts"}) {
+			t.Errorf("notifications for %s after invisible change = %v, want prompts", id, got)
+		}
+	}
 }
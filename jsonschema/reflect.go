@@ -0,0 +1,343 @@
+package jsonschema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Schemer provides its own schema. Types implementing it are not reflected.
+type Schemer interface {
+	JSONSchema() *Schema
+}
+
+var (
+	schemerType    = reflect.TypeFor[Schemer]()
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	textMarshaler  = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// For returns a schema describing the JSON encoding of T. See [Reflect].
+func For[T any]() (*Schema, error) {
+	return Reflect(reflect.TypeFor[T]())
+}
+
+// Reflect returns a schema describing the JSON encoding of values of type t.
+//
+// Struct fields are named by their `json` tag. A field is required unless it
+// is a pointer or tagged omitempty or omitzero. Pointers, slices and maps may
+// also be null. The following struct tags refine a field's schema:
+//
+//	description:"The city to look up"
+//	enum:"celsius,fahrenheit"
+//	minimum:"0"
+//	maximum:"100"
+//	pattern:"^[A-Z]{2}$"
+//	default:"celsius"
+//
+// For slice and array fields, enum, minimum, maximum and pattern apply to the
+// elements. time.Time is a date-time string, []byte a base64 string and
+// json.RawMessage any value. Recursive types are placed in $defs and
+// referenced with $ref.
+func Reflect(t reflect.Type) (*Schema, error) {
+	r := &reflector{
+		root:       t,
+		defs:       map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+		inProgress: map[reflect.Type]bool{},
+		recursive:  map[reflect.Type]bool{},
+	}
+	s, err := r.reflect(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.defs) > 0 {
+		s.Defs = r.defs
+	}
+	return s, nil
+}
+
+type reflector struct {
+	root       reflect.Type
+	defs       map[string]*Schema
+	names      map[reflect.Type]string
+	inProgress map[reflect.Type]bool
+	recursive  map[reflect.Type]bool
+}
+
+func (r *reflector) reflect(t reflect.Type) (*Schema, error) {
+	if t.Implements(schemerType) {
+		return reflect.New(t).Elem().Interface().(Schemer).JSONSchema(), nil
+	}
+	if t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(schemerType) {
+		return reflect.New(t).Interface().(Schemer).JSONSchema(), nil
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case rawMessageType:
+		return &Schema{}, nil
+	}
+	if t.Kind() != reflect.Pointer && (t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler)) {
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		s, err := r.reflect(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(s), nil
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &Schema{Type: "integer", Minimum: &zero}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Types: []string{"string", "null"}, ContentEncoding: "base64"}, nil
+		}
+		items, err := r.reflect(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Types: []string{"array", "null"}, Items: items}, nil
+	case reflect.Array:
+		items, err := r.reflect(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		n := t.Len()
+		return &Schema{Type: "array", Items: items, MinItems: &n, MaxItems: &n}, nil
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			if !t.Key().Implements(textMarshaler) {
+				return nil, fmt.Errorf("jsonschema: unsupported map key type %s", t.Key())
+			}
+		}
+		values, err := r.reflect(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Types: []string{"object", "null"}, AdditionalProperties: values}, nil
+	case reflect.Struct:
+		return r.reflectStruct(t)
+	default:
+		return nil, fmt.Errorf("jsonschema: unsupported type %s", t)
+	}
+}
+
+// reflectStruct returns the schema for a struct type. A type that refers to
+// itself is moved to $defs, except for the root type, which is referenced as
+// "#".
+func (r *reflector) reflectStruct(t reflect.Type) (*Schema, error) {
+	if name, ok := r.names[t]; ok && r.defs[name] != nil {
+		return &Schema{Ref: "#/$defs/" + name}, nil
+	}
+	if r.inProgress[t] {
+		if t == r.root {
+			return &Schema{Ref: "#"}, nil
+		}
+		r.recursive[t] = true
+		return &Schema{Ref: "#/$defs/" + r.defName(t)}, nil
+	}
+
+	r.inProgress[t] = true
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if err := r.reflectFields(t, s); err != nil {
+		return nil, err
+	}
+	delete(r.inProgress, t)
+
+	if r.recursive[t] {
+		name := r.defName(t)
+		r.defs[name] = s
+		return &Schema{Ref: "#/$defs/" + name}, nil
+	}
+	return s, nil
+}
+
+// defName returns the $defs key for a type, picking a unique one the first
+// time the type is seen.
+func (r *reflector) defName(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+	base := t.Name()
+	if base == "" {
+		base = "Type"
+	}
+	base = strings.NewReplacer("[", "_", "]", "", "/", "_", ".", "_", ",", "_", "*", "").Replace(base)
+	taken := map[string]bool{}
+	for _, n := range r.names {
+		taken[n] = true
+	}
+	name := base
+	for i := 2; taken[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	r.names[t] = name
+	return name
+}
+
+func (r *reflector) reflectFields(t reflect.Type, s *Schema) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if err := r.reflectFields(ft, s); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs, err := r.reflect(f.Type)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if hasOption(opts, "string") {
+			switch f.Type.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				fs = &Schema{Type: "string"}
+			}
+		}
+		if err := applyTags(fs, f); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+
+		s.Properties[name] = fs
+		if f.Type.Kind() != reflect.Pointer && !hasOption(opts, "omitempty") && !hasOption(opts, "omitzero") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return nil
+}
+
+// applyTags refines a field schema with the description, enum, minimum,
+// maximum, pattern and default struct tags.
+func applyTags(s *Schema, f reflect.StructField) error {
+	if desc, ok := f.Tag.Lookup("description"); ok {
+		s.Description = desc
+	}
+
+	target, kind := s, f.Type.Kind()
+	elem := f.Type
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+		kind = elem.Kind()
+	}
+	if (kind == reflect.Slice || kind == reflect.Array) && s.Items != nil {
+		target, kind = s.Items, elem.Elem().Kind()
+	}
+
+	if enum, ok := f.Tag.Lookup("enum"); ok {
+		for _, v := range strings.Split(enum, ",") {
+			raw, err := tagValue(kind, v)
+			if err != nil {
+				return fmt.Errorf("enum: %w", err)
+			}
+			target.Enum = append(target.Enum, raw)
+		}
+	}
+	if v, ok := f.Tag.Lookup("minimum"); ok {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("minimum: %w", err)
+		}
+		target.Minimum = &n
+	}
+	if v, ok := f.Tag.Lookup("maximum"); ok {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("maximum: %w", err)
+		}
+		target.Maximum = &n
+	}
+	if v, ok := f.Tag.Lookup("pattern"); ok {
+		target.Pattern = v
+	}
+	if v, ok := f.Tag.Lookup("default"); ok {
+		raw, err := tagValue(kind, v)
+		if err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+		s.Default = raw
+	}
+	return nil
+}
+
+// tagValue converts a struct tag value into JSON. Strings are quoted; any
+// other kind must already be valid JSON.
+func tagValue(kind reflect.Kind, v string) (json.RawMessage, error) {
+	if kind == reflect.String {
+		return json.Marshal(v)
+	}
+	if !json.Valid([]byte(v)) {
+		return nil, fmt.Errorf("invalid JSON value %q", v)
+	}
+	return json.RawMessage(v), nil
+}
+
+// nullable extends a schema to also accept null.
+func nullable(s *Schema) *Schema {
+	switch {
+	case len(s.Types) > 0:
+		for _, t := range s.Types {
+			if t == "null" {
+				return s
+			}
+		}
+		s.Types = append(s.Types, "null")
+	case s.Type != "":
+		s.Types = []string{s.Type, "null"}
+		s.Type = ""
+	case s.Ref != "":
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	return s
+}
+
+func hasOption(opts, name string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type forecastArgs struct {
+	City    string          `json:"city" description:"City name" pattern:"^[A-Z]"`
+	Units   string          `json:"units,omitempty" enum:"celsius,fahrenheit" default:"celsius"`
+	Days    int             `json:"days" minimum:"1" maximum:"7"`
+	Tags    []string        `json:"tags,omitempty" enum:"rain,sun"`
+	When    *time.Time      `json:"when"`
+	Extra   json.RawMessage `json:"extra,omitempty"`
+	Ignored string          `json:"-"`
+	hidden  string
+}
+
+type node struct {
+	Value    int     `json:"value"`
+	Children []*node `json:"children"`
+}
+
+type tree struct {
+	Root *node `json:"root"`
+}
+
+func mustJSON(t *testing.T, s *Schema) string {
+	t.Helper()
+	bs, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("failed to marshal schema: %v", err)
+	}
+	return string(bs)
+}
+
+func TestReflect(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		got  func() (*Schema, error)
+		want string
+	}{
+		{
+			name: "scalars",
+			got:  For[int],
+			want: `{"type":"integer"}`,
+		},
+		{
+			name: "map",
+			got:  For[map[string]bool],
+			want: `{"type":["object","null"],"additionalProperties":{"type":"boolean"}}`,
+		},
+		{
+			name: "tags",
+			got:  For[forecastArgs],
+			want: `{"type":"object","properties":{` +
+				`"city":{"type":"string","description":"City name","pattern":"^[A-Z]"},` +
+				`"days":{"type":"integer","minimum":1,"maximum":7},` +
+				`"extra":{},` +
+				`"tags":{"type":["array","null"],"items":{"type":"string","enum":["rain","sun"]}},` +
+				`"units":{"type":"string","default":"celsius","enum":["celsius","fahrenheit"]},` +
+				`"when":{"type":["string","null"],"format":"date-time"}` +
+				`},"required":["city","days"]}`,
+		},
+		{
+			name: "self reference",
+			got:  For[node],
+			want: `{"type":"object","properties":{` +
+				`"children":{"type":["array","null"],"items":{"anyOf":[{"$ref":"#"},{"type":"null"}]}},` +
+				`"value":{"type":"integer"}` +
+				`},"required":["value","children"]}`,
+		},
+		{
+			name: "recursive defs",
+			got:  For[tree],
+			want: `{"type":"object","$defs":{"node":{"type":"object","properties":{` +
+				`"children":{"type":["array","null"],"items":{"anyOf":[{"$ref":"#/$defs/node"},{"type":"null"}]}},` +
+				`"value":{"type":"integer"}` +
+				`},"required":["value","children"]}},` +
+				`"properties":{"root":{"anyOf":[{"$ref":"#/$defs/node"},{"type":"null"}]}}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := tc.got()
+			if err != nil {
+				t.Fatalf("failed to reflect: %v", err)
+			}
+			if got := mustJSON(t, s); got != tc.want {
+				t.Fatalf("unexpected schema\n got: %s\nwant: %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReflectUnsupported(t *testing.T) {
+	if _, err := For[struct{ C chan int }](); err == nil {
+		t.Fatal("expected an error for a channel field")
+	}
+}
+
+func TestSchemaRoundTrip(t *testing.T) {
+	in := `{"type":["string","null"],"additionalProperties":false,"items":true}`
+	var s Schema
+	if err := json.Unmarshal([]byte(in), &s); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if got := mustJSON(t, &s); got != in {
+		t.Fatalf("unexpected schema\n got: %s\nwant: %s", got, in)
+	}
+}
@@ -0,0 +1,147 @@
+// Package jsonschema implements the parts of JSON Schema (draft 2020-12) used
+// by the Model Context Protocol: a [Schema] type, reflection of Go types into
+// schemas, and validation of JSON values against them.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Draft is the URI of the JSON Schema dialect this package implements.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document or subschema.
+//
+// Instance values (const, enum and default) are kept as raw JSON so they can
+// be compared and re-encoded without losing precision.
+type Schema struct {
+	Schema string             `json:"$schema,omitempty"`
+	ID     string             `json:"$id,omitempty"`
+	Ref    string             `json:"$ref,omitempty"`
+	Defs   map[string]*Schema `json:"$defs,omitempty"`
+
+	// Definitions is the pre-2019 name for $defs, still used by many
+	// schemas in the wild.
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+
+	Title       string          `json:"title,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Default     json.RawMessage `json:"default,omitempty"`
+
+	// Type holds a single type name. Types holds the list form of the type
+	// keyword and takes precedence when set.
+	Type  string   `json:"-"`
+	Types []string `json:"-"`
+
+	Enum  []json.RawMessage `json:"enum,omitempty"`
+	Const json.RawMessage   `json:"const,omitempty"`
+
+	AllOf []*Schema `json:"allOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	Not   *Schema   `json:"not,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema `json:"patternProperties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	MinProperties        *int               `json:"minProperties,omitempty"`
+	MaxProperties        *int               `json:"maxProperties,omitempty"`
+
+	Items       *Schema   `json:"items,omitempty"`
+	PrefixItems []*Schema `json:"prefixItems,omitempty"`
+	MinItems    *int      `json:"minItems,omitempty"`
+	MaxItems    *int      `json:"maxItems,omitempty"`
+	UniqueItems bool      `json:"uniqueItems,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Format    string `json:"format,omitempty"`
+
+	ContentEncoding  string `json:"contentEncoding,omitempty"`
+	ContentMediaType string `json:"contentMediaType,omitempty"`
+
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+	MultipleOf       *float64 `json:"multipleOf,omitempty"`
+
+	// boolean is set for the boolean schemas true and false.
+	boolean *bool
+}
+
+// True returns the schema that every value satisfies.
+func True() *Schema {
+	b := true
+	return &Schema{boolean: &b}
+}
+
+// False returns the schema that no value satisfies.
+func False() *Schema {
+	b := false
+	return &Schema{boolean: &b}
+}
+
+// TypeNames returns the types the schema allows, or nil if it doesn't
+// constrain the type.
+func (s *Schema) TypeNames() []string {
+	if len(s.Types) > 0 {
+		return s.Types
+	}
+	if s.Type != "" {
+		return []string{s.Type}
+	}
+	return nil
+}
+
+type schemaFields Schema
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.boolean != nil {
+		return json.Marshal(*s.boolean)
+	}
+	var typ any
+	if len(s.Types) > 0 {
+		typ = s.Types
+	} else if s.Type != "" {
+		typ = s.Type
+	}
+	return json.Marshal(struct {
+		Type any `json:"type,omitempty"`
+		*schemaFields
+	}{typ, (*schemaFields)(s)})
+}
+
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && (data[0] == 't' || data[0] == 'f') {
+		var b bool
+		if err := json.Unmarshal(data, &b); err != nil {
+			return err
+		}
+		*s = Schema{boolean: &b}
+		return nil
+	}
+	var aux struct {
+		Type json.RawMessage `json:"type"`
+		*schemaFields
+	}
+	aux.schemaFields = (*schemaFields)(s)
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if len(aux.Type) == 0 {
+		return nil
+	}
+	if aux.Type[0] == '[' {
+		return json.Unmarshal(aux.Type, &s.Types)
+	}
+	if err := json.Unmarshal(aux.Type, &s.Type); err != nil {
+		return errors.New("jsonschema: type must be a string or an array of strings")
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidationError lists every way a value fails to satisfy a schema.
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+// FieldError describes a single failure. Path is a JSON pointer to the
+// offending value; the empty string refers to the value itself.
+type FieldError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Path == "" {
+			msgs = append(msgs, fe.Message)
+		} else {
+			msgs = append(msgs, fe.Path+": "+fe.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidateJSON decodes data, which must hold a single JSON value, and
+// validates it against the schema.
+func (s *Schema) ValidateJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid JSON: data after the value at offset %d", dec.InputOffset())
+	}
+	return s.Validate(v)
+}
+
+// Validate checks a decoded JSON value against the schema and returns a
+// [*ValidationError] if it doesn't conform. Values are expected in the form
+// produced by encoding/json: map[string]any, []any, string, bool, nil and
+// float64 or json.Number.
+//
+// The format keyword is treated as an annotation and not checked. $ref
+// supports "#" and pointers into the root schema's $defs or definitions.
+func (s *Schema) Validate(v any) error {
+	vs := &validator{root: s, refs: map[refVisit]bool{}}
+	vs.validate(s, v, "")
+	if len(vs.errs) > 0 {
+		return &ValidationError{Errors: vs.errs}
+	}
+	return nil
+}
+
+type validator struct {
+	root *Schema
+	errs []FieldError
+
+	// refs holds the $refs being followed at each instance location, so
+	// that a cycle that never descends into the value is reported instead
+	// of recursing forever.
+	refs map[refVisit]bool
+}
+
+type refVisit struct {
+	ref, path string
+}
+
+func (vs *validator) fail(path, format string, args ...any) {
+	vs.errs = append(vs.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// valid reports whether v satisfies s without recording any errors.
+func (vs *validator) valid(s *Schema, v any, path string) bool {
+	sub := &validator{root: vs.root, refs: vs.refs}
+	sub.validate(s, v, path)
+	return len(sub.errs) == 0
+}
+
+func (vs *validator) validate(s *Schema, v any, path string) {
+	if s == nil {
+		return
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			vs.fail(path, "no value is allowed")
+		}
+		return
+	}
+
+	if s.Ref != "" {
+		visit := refVisit{s.Ref, path}
+		if vs.refs[visit] {
+			vs.fail(path, "circular $ref %q", s.Ref)
+			return
+		}
+		ref, err := vs.resolve(s.Ref)
+		if err != nil {
+			vs.fail(path, "%v", err)
+			return
+		}
+		vs.refs[visit] = true
+		vs.validate(ref, v, path)
+		delete(vs.refs, visit)
+	}
+
+	if types := s.TypeNames(); len(types) > 0 {
+		ok := false
+		for _, t := range types {
+			if hasType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			vs.fail(path, "expected %s, got %s", strings.Join(types, " or "), typeOf(v))
+			return
+		}
+	}
+
+	if len(s.Const) > 0 && !equal(v, decode(s.Const)) {
+		vs.fail(path, "must be %s", s.Const)
+	}
+	if len(s.Enum) > 0 {
+		ok := false
+		for _, e := range s.Enum {
+			if equal(v, decode(e)) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			vs.fail(path, "must be one of %s", joinRaw(s.Enum))
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		vs.validate(sub, v, path)
+	}
+	if len(s.AnyOf) > 0 {
+		ok := false
+		for _, sub := range s.AnyOf {
+			if vs.valid(sub, v, path) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			vs.fail(path, "does not match any of the allowed schemas")
+		}
+	}
+	if len(s.OneOf) > 0 {
+		n := 0
+		for _, sub := range s.OneOf {
+			if vs.valid(sub, v, path) {
+				n++
+			}
+		}
+		if n != 1 {
+			vs.fail(path, "must match exactly one schema, matched %d", n)
+		}
+	}
+	if s.Not != nil && vs.valid(s.Not, v, path) {
+		vs.fail(path, "must not match the schema")
+	}
+
+	switch v := v.(type) {
+	case string:
+		vs.validateString(s, v, path)
+	case json.Number, float64:
+		vs.validateNumber(s, v, path)
+	case []any:
+		vs.validateArray(s, v, path)
+	case map[string]any:
+		vs.validateObject(s, v, path)
+	}
+}
+
+func (vs *validator) validateString(s *Schema, v string, path string) {
+	n := utf8.RuneCountInString(v)
+	if s.MinLength != nil && n < *s.MinLength {
+		vs.fail(path, "must be at least %d characters long", *s.MinLength)
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		vs.fail(path, "must be at most %d characters long", *s.MaxLength)
+	}
+	if s.Pattern != "" {
+		re, err := compilePattern(s.Pattern)
+		if err != nil {
+			vs.fail(path, "invalid pattern %q: %v", s.Pattern, err)
+		} else if !re.MatchString(v) {
+			vs.fail(path, "must match pattern %q", s.Pattern)
+		}
+	}
+}
+
+func (vs *validator) validateNumber(s *Schema, v any, path string) {
+	f, _ := toFloat(v)
+	if s.Minimum != nil && f < *s.Minimum {
+		vs.fail(path, "must be greater than or equal to %v", *s.Minimum)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		vs.fail(path, "must be less than or equal to %v", *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+		vs.fail(path, "must be greater than %v", *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+		vs.fail(path, "must be less than %v", *s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		x, ok1 := new(big.Rat).SetString(numberString(v))
+		m, ok2 := new(big.Rat).SetString(strconv.FormatFloat(*s.MultipleOf, 'g', -1, 64))
+		if ok1 && ok2 && !new(big.Rat).Quo(x, m).IsInt() {
+			vs.fail(path, "must be a multiple of %v", *s.MultipleOf)
+		}
+	}
+}
+
+func (vs *validator) validateArray(s *Schema, v []any, path string) {
+	if s.MinItems != nil && len(v) < *s.MinItems {
+		vs.fail(path, "must have at least %d items", *s.MinItems)
+	}
+	if s.MaxItems != nil && len(v) > *s.MaxItems {
+		vs.fail(path, "must have at most %d items", *s.MaxItems)
+	}
+	for i, item := range v {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(s.PrefixItems) {
+			vs.validate(s.PrefixItems[i], item, itemPath)
+		} else {
+			vs.validate(s.Items, item, itemPath)
+		}
+	}
+	if s.UniqueItems {
+		for i := range v {
+			for j := i + 1; j < len(v); j++ {
+				if equal(v[i], v[j]) {
+					vs.fail(path, "items %d and %d are equal", i, j)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (vs *validator) validateObject(s *Schema, v map[string]any, path string) {
+	if s.MinProperties != nil && len(v) < *s.MinProperties {
+		vs.fail(path, "must have at least %d properties", *s.MinProperties)
+	}
+	if s.MaxProperties != nil && len(v) > *s.MaxProperties {
+		vs.fail(path, "must have at most %d properties", *s.MaxProperties)
+	}
+	for _, name := range s.Required {
+		if _, ok := v[name]; !ok {
+			vs.fail(path+"/"+escape(name), "is required")
+		}
+	}
+	for _, name := range sortedKeys(v) {
+		value := v[name]
+		propPath := path + "/" + escape(name)
+		matched := false
+		if sub, ok := s.Properties[name]; ok {
+			matched = true
+			vs.validate(sub, value, propPath)
+		}
+		for pattern, sub := range s.PatternProperties {
+			re, err := compilePattern(pattern)
+			if err != nil {
+				vs.fail(propPath, "invalid pattern %q: %v", pattern, err)
+				continue
+			}
+			if re.MatchString(name) {
+				matched = true
+				vs.validate(sub, value, propPath)
+			}
+		}
+		if !matched && s.AdditionalProperties != nil {
+			if b := s.AdditionalProperties.boolean; b != nil && !*b {
+				vs.fail(propPath, "is not allowed")
+				continue
+			}
+			vs.validate(s.AdditionalProperties, value, propPath)
+		}
+	}
+}
+
+// resolve looks up a $ref relative to the root schema.
+func (vs *validator) resolve(ref string) (*Schema, error) {
+	if ref == "#" {
+		return vs.root, nil
+	}
+	if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+		if s, ok := vs.root.Defs[unescape(name)]; ok {
+			return s, nil
+		}
+	}
+	if name, ok := strings.CutPrefix(ref, "#/definitions/"); ok {
+		if s, ok := vs.root.Definitions[unescape(name)]; ok {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unresolvable $ref %q", ref)
+}
+
+var patterns sync.Map
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		f, ok := toFloat(v)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	default:
+		return false
+	}
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func numberString(v any) string {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String()
+	case float64:
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// equal compares two decoded JSON values, treating numbers by value.
+func equal(a, b any) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, va := range a {
+			vb, ok := b[k]
+			if !ok || !equal(va, vb) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func decode(raw json.RawMessage) any {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	dec.Decode(&v)
+	return v
+}
+
+func joinRaw(values []json.RawMessage) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = string(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func escape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
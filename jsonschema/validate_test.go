@@ -0,0 +1,169 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 2, "pattern": "^[a-z]+$"},
+			"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+			"price": {"type": "number", "multipleOf": 0.01},
+			"tags": {"type": "array", "items": {"enum": ["a", "b"]}, "uniqueItems": true},
+			"pair": {"type": "array", "prefixItems": [{"type": "string"}, {"type": "integer"}], "items": false},
+			"kind": {"oneOf": [{"const": "x"}, {"const": "y"}]},
+			"child": {"$ref": "#/$defs/child"}
+		},
+		"required": ["name"],
+		"additionalProperties": false,
+		"$defs": {
+			"child": {"type": "object", "properties": {"child": {"$ref": "#/$defs/child"}}, "maxProperties": 1}
+		}
+	}`
+	var s Schema
+	if err := json.Unmarshal([]byte(schema), &s); err != nil {
+		t.Fatalf("failed to unmarshal schema: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		want  []FieldError
+	}{
+		{
+			name:  "valid",
+			value: `{"name": "ada", "age": 36, "price": 1.10, "tags": ["a", "b"], "pair": ["x", 1], "kind": "y", "child": {"child": {}}}`,
+		},
+		{
+			name:  "wrong type",
+			value: `[]`,
+			want:  []FieldError{{Path: "", Message: "expected object, got array"}},
+		},
+		{
+			name:  "missing and extra",
+			value: `{"nickname": "ada"}`,
+			want: []FieldError{
+				{Path: "/name", Message: "is required"},
+				{Path: "/nickname", Message: "is not allowed"},
+			},
+		},
+		{
+			name:  "nested failures",
+			value: `{"name": "A", "age": 1.5, "price": 1.001, "tags": ["a", "a", "c"], "pair": ["x", 1, 2], "kind": "z", "child": {"child": {"a": 1, "b": 2}}}`,
+			want: []FieldError{
+				{Path: "/age", Message: "expected integer, got number"},
+				{Path: "/child/child", Message: "must have at most 1 properties"},
+				{Path: "/kind", Message: "must match exactly one schema, matched 0"},
+				{Path: "/name", Message: "must be at least 2 characters long"},
+				{Path: "/name", Message: `must match pattern "^[a-z]+$"`},
+				{Path: "/pair/2", Message: "no value is allowed"},
+				{Path: "/price", Message: "must be a multiple of 0.01"},
+				{Path: "/tags/2", Message: `must be one of "a", "b"`},
+				{Path: "/tags", Message: "items 0 and 1 are equal"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.ValidateJSON([]byte(tc.value))
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if !reflect.DeepEqual(verr.Errors, tc.want) {
+				t.Fatalf("unexpected errors\n got: %+v\nwant: %+v", verr.Errors, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateReflected(t *testing.T) {
+	s, err := For[forecastArgs]()
+	if err != nil {
+		t.Fatalf("failed to reflect: %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`{"city": "Paris", "days": 3, "when": null}`)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := s.ValidateJSON([]byte(`{"city": "paris", "days": 8, "units": "kelvin"}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestValidateTrailingData(t *testing.T) {
+	var s Schema
+	for _, value := range []string{`{"a": 1} garbage`, `{"a": 1} {}`, `1 2`} {
+		err := s.ValidateJSON([]byte(value))
+		var verr *ValidationError
+		if err == nil || errors.As(err, &verr) {
+			t.Errorf("ValidateJSON(%s): got %v, want a decoding error", value, err)
+		}
+	}
+	if err := s.ValidateJSON([]byte("{\"a\": 1}\n")); err != nil {
+		t.Errorf("trailing whitespace: %v", err)
+	}
+}
+
+func TestValidateRefs(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		schema string
+		value  string
+		want   []FieldError
+	}{
+		{
+			name:   "definitions",
+			schema: `{"properties": {"a": {"$ref": "#/definitions/pos"}}, "definitions": {"pos": {"minimum": 0}}}`,
+			value:  `{"a": -1}`,
+			want:   []FieldError{{Path: "/a", Message: "must be greater than or equal to 0"}},
+		},
+		{
+			name:   "recursive",
+			schema: `{"type": "array", "items": {"$ref": "#"}}`,
+			value:  `[[], [[]]]`,
+		},
+		{
+			name:   "self",
+			schema: `{"$ref": "#"}`,
+			value:  `1`,
+			want:   []FieldError{{Path: "", Message: `circular $ref "#"`}},
+		},
+		{
+			name:   "cycle",
+			schema: `{"$ref": "#/$defs/a", "$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"$ref": "#/$defs/a"}}}`,
+			value:  `{}`,
+			want:   []FieldError{{Path: "", Message: `circular $ref "#/$defs/a"`}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Schema
+			if err := json.Unmarshal([]byte(tc.schema), &s); err != nil {
+				t.Fatalf("failed to unmarshal schema: %v", err)
+			}
+			err := s.ValidateJSON([]byte(tc.value))
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if !reflect.DeepEqual(verr.Errors, tc.want) {
+				t.Fatalf("unexpected errors\n got: %+v\nwant: %+v", verr.Errors, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+)
+
+// QueueStats describes the load on a server's message loop.
+type QueueStats struct {
+	// InFlight is the number of messages being handled.
+	InFlight int
+	// Queued is the number of messages waiting for a free slot.
+	Queued int
+	// Rejected counts the requests answered with [CodeOverloaded].
+	Rejected uint64
+	// Blocked reports whether the server has stopped reading from the
+	// stream because the queue is full.
+	Blocked bool
+	// Sessions maps each session with messages in flight or queued to its
+	// number of messages in flight.
+	Sessions map[string]int
+}
+
+// limiter bounds the number of messages handled at once, globally and per
+// session. Messages over the limits wait in a queue; once the queue is full
+// the message loop stops reading from the stream until there is room, or
+// rejects requests outright if reject is set.
+type limiter struct {
+	global     int // 0 means no limit
+	perSession int // 0 means no limit
+	queueSize  int
+	reject     bool
+
+	mu       sync.Mutex
+	inFlight int
+	sessions map[string]int
+	queue    []*job
+	rejected uint64
+	blocked  bool
+	changed  chan struct{} // closed and replaced whenever a slot frees up
+}
+
+type job struct {
+	session string
+	run     func()
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		sessions: map[string]int{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// canStart reports whether a message for session fits within the limits.
+// l.mu must be held.
+func (l *limiter) canStart(session string) bool {
+	if l.global > 0 && l.inFlight >= l.global {
+		return false
+	}
+	return l.perSession <= 0 || l.sessions[session] < l.perSession
+}
+
+// start runs j in a new goroutine. l.mu must be held.
+func (l *limiter) start(j *job) {
+	l.inFlight++
+	l.sessions[j.session]++
+	go func() {
+		defer l.done(j.session)
+		j.run()
+	}()
+}
+
+// submit runs run once the limits allow it. It blocks while the queue is
+// full, unless canReject is set and the limiter rejects overflow, in which
+// case it returns false without running anything. It also returns false if
+// ctx ends while it waits.
+func (l *limiter) submit(ctx context.Context, session string, canReject bool, run func()) bool {
+	j := &job{session: session, run: run}
+	for {
+		l.mu.Lock()
+		l.blocked = false
+		if l.canStart(session) {
+			l.start(j)
+			l.mu.Unlock()
+			return true
+		}
+		if len(l.queue) < l.queueSize {
+			l.queue = append(l.queue, j)
+			l.mu.Unlock()
+			return true
+		}
+		if l.reject && canReject {
+			l.rejected++
+			l.mu.Unlock()
+			return false
+		}
+		l.blocked = true
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.blocked = false
+			l.mu.Unlock()
+			return false
+		}
+	}
+}
+
+// done releases a slot and starts as many queued messages as now fit.
+func (l *limiter) done(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if l.sessions[session]--; l.sessions[session] <= 0 {
+		delete(l.sessions, session)
+	}
+	for i := 0; i < len(l.queue); {
+		j := l.queue[i]
+		if !l.canStart(j.session) {
+			i++
+			continue
+		}
+		l.queue = append(l.queue[:i], l.queue[i+1:]...)
+		l.start(j)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *limiter) stats() QueueStats {
+	if l == nil {
+		return QueueStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := QueueStats{
+		InFlight: l.inFlight,
+		Queued:   len(l.queue),
+		Rejected: l.rejected,
+		Blocked:  l.blocked,
+		Sessions: make(map[string]int, len(l.sessions)),
+	}
+	for id, n := range l.sessions {
+		stats.Sessions[id] = n
+	}
+	for _, j := range l.queue {
+		if _, ok := stats.Sessions[j.session]; !ok {
+			stats.Sessions[j.session] = 0
+		}
+	}
+	return stats
+}
@@ -6,6 +6,7 @@ type Request[T any] struct {
 	method   string
 	id       string
 	metadata map[string]string
+	outgoing bool
 }
 
 func (r *Request[T]) ID() string {
@@ -32,6 +33,12 @@ func (r *Request[_]) Method() string {
 	return r.method
 }
 
+// Outgoing reports whether the request is being sent to the peer rather than
+// received from it. Interceptors see both.
+func (r *Request[_]) Outgoing() bool {
+	return r.outgoing
+}
+
 // internalOnly implements AnyRequest.
 func (r *Request[_]) internalOnly() {}
 
@@ -46,6 +53,7 @@ type AnyRequest interface {
 	ID() string
 	Method() string
 	Metadata() map[string]string
+	Outgoing() bool
 	internalOnly()
 }
 
@@ -91,15 +99,69 @@ type AnyResponse interface {
 	internalOnly()
 }
 
+// Error codes defined by JSON-RPC 2.0.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// Error codes defined by the Model Context Protocol.
+const (
+	CodeResourceNotFound = -32002
+)
+
+// Error codes used by this package, from the range JSON-RPC reserves for
+// implementations.
+const (
+	// CodeConnectionClosed reports a request that can't complete because
+	// the connection is shutting down or has closed.
+	CodeConnectionClosed = -32000
+
+	// CodeRequestTimeout reports a request that didn't complete before its
+	// deadline. See [WithCallTimeout] and [WithHandlerTimeout].
+	CodeRequestTimeout = -32001
+
+	// CodeOverloaded rejects a request the server has no capacity for. See
+	// [WithOverloadedError].
+	CodeOverloaded = -32003
+)
+
+// Error is an error with a JSON-RPC error code. Handlers return an *Error to
+// control the code sent to the peer; any other error is sent with code 9.
 type Error struct {
 	code int
 	err  error
+	data any
 }
 
 func (e *Error) Error() string {
 	return e.err.Error()
 }
 
+// Code returns the JSON-RPC error code.
+func (e *Error) Code() int {
+	return e.code
+}
+
+// Data returns additional information about the error. For errors received
+// from a peer it is the raw JSON data member, if any.
+func (e *Error) Data() any {
+	return e.data
+}
+
+// WithData returns a copy of the error that sends data, encoded as JSON, as
+// the data member of the error response.
+func (e *Error) WithData(data any) *Error {
+	return &Error{code: e.code, err: e.err, data: data}
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
 func NewError(code int, underlying error) *Error {
 	return &Error{code: code, err: underlying}
 }
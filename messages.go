@@ -10,8 +10,9 @@ type InitializeRequest struct {
 
 // Capabilities represents the available feature capabilities
 type ClientCapabilities struct {
-	Roots    Roots    `json:"roots"`
-	Sampling Sampling `json:"sampling"`
+	Roots        Roots                      `json:"roots"`
+	Sampling     Sampling                   `json:"sampling"`
+	Experimental map[string]json.RawMessage `json:"experimental,omitempty"`
 }
 
 // Roots contains root-level capabilities
@@ -47,6 +48,9 @@ type ServerCapabilities struct {
 	Tools     *Tools     `json:"tools,omitempty"`
 	Resources *Resources `json:"resources,omitempty"`
 	Prompts   *Prompts   `json:"prompts,omitempty"`
+
+	// Experimental lists non-standard capabilities, keyed by name.
+	Experimental map[string]json.RawMessage `json:"experimental,omitempty"`
 }
 
 type Logging struct{}
@@ -56,6 +60,7 @@ type Prompts struct {
 }
 
 type Resources struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
 	ListChanged bool `json:"listChanged,omitempty"`
 }
 
@@ -73,9 +78,10 @@ type ListToolsResponse struct {
 }
 
 type Tool struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	InputSchema json.RawMessage `json:"inputSchema"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description"`
+	InputSchema  json.RawMessage `json:"inputSchema"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
 }
 
 type CallToolRequest struct {
@@ -84,15 +90,17 @@ type CallToolRequest struct {
 }
 
 type CallToolResponse struct {
-	IsError bool      `json:"isError"`
-	Content []Content `json:"content"`
+	IsError           bool            `json:"isError"`
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
 }
 
 type Content struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	Data     string `json:"data,omitempty"`
-	MimeType string `json:"mimeType,omitempty"`
+	Type     string           `json:"type"`
+	Text     string           `json:"text,omitempty"`
+	Data     string           `json:"data,omitempty"`
+	MimeType string           `json:"mimeType,omitempty"`
+	Resource *ResourceContent `json:"resource,omitempty"`
 }
 
 type Prompt struct {
@@ -126,6 +134,11 @@ type GetPromptResponse struct {
 	Messages    []PromptMessage `json:"messages"`
 }
 
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
 type PromptMessage struct {
 	Role    string  `json:"role"`
 	Content Content `json:"content"`
@@ -162,6 +175,29 @@ type ResourceContent struct {
 	Blob     string `json:"blob,omitempty"`
 }
 
+type SubscribeRequest struct {
+	URI string `json:"uri"`
+}
+
+type SubscribeResponse struct {
+}
+
+type UnsubscribeRequest struct {
+	URI string `json:"uri"`
+}
+
+type UnsubscribeResponse struct {
+}
+
+type ResourceUpdatedNotification struct {
+	URI string `json:"uri"`
+}
+
+type CancelledNotification struct {
+	RequestID json.Number `json:"requestId"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
 type ListResourceTemplatesRequest struct {
 	Cursor string `json:"cursor,omitempty"`
 }
@@ -183,9 +219,12 @@ type CompletionRequest struct {
 	Argument CompletionArgument `json:"argument"`
 }
 
+// A CompletionRef is either a prompt, with Type "ref/prompt" and its Name, or
+// a resource template, with Type "ref/resource" and its URI.
 type CompletionRef struct {
 	Type string `json:"type"`
-	Name string `json:"name"`
+	Name string `json:"name,omitempty"`
+	URI  string `json:"uri,omitempty"`
 }
 
 type CompletionArgument struct {
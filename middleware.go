@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// InvocationKind says what an [Invocation] invokes.
+type InvocationKind string
+
+const (
+	ToolInvocation     InvocationKind = "tool"
+	PromptInvocation   InvocationKind = "prompt"
+	ResourceInvocation InvocationKind = "resource"
+)
+
+// An Invocation is a call to a tool, prompt or resource in a registry, as
+// seen by [Middleware].
+type Invocation struct {
+	Kind InvocationKind
+	// Name is the name of the tool or prompt, or the URI or URI template
+	// the resource was registered with.
+	Name string
+	// Tags are the tags the tool, prompt or resource was registered with.
+	Tags []string
+	// Args holds the decoded arguments: the Args value of a tool added with
+	// [AddTool], the arguments of a prompt as a map[string]string, or the
+	// template variables of a resource as a map[string]string, which is nil
+	// for static resources. Middleware can replace it with a value of the
+	// same type.
+	Args any
+	// URI is the URI requested from a resource.
+	URI string
+	// Request is the request being served.
+	Request AnyRequest
+}
+
+// An InvokeFunc performs an [Invocation]. It returns the value a tool
+// handler, prompt renderer or resource reader produced: a tool result in any
+// form accepted from a [ToolFunc], a []PromptMessage or a []ResourceContent.
+// Middleware that short-circuits an invocation returns a value of the same
+// kind.
+type InvokeFunc func(ctx context.Context, inv *Invocation) (any, error)
+
+// Middleware wraps calls to tools, prompts or resources in a registry,
+// like an [Interceptor] does for every request. Attach it to one tool, prompt
+// or resource with [WithMiddleware], to every item with a tag with the
+// registry's UseTag method, or to the whole registry with its Use method.
+//
+// Registry-wide middleware runs first, then tag middleware in the order it
+// was added, then the item's own middleware.
+type Middleware func(next InvokeFunc) InvokeFunc
+
+// A RegistrationOption configures a tool, prompt or resource added to a
+// registry.
+type RegistrationOption interface {
+	applyToRegistration(r *registration)
+}
+
+// WithTags tags a tool, prompt or resource so that middleware added to a
+// registry with UseTag applies to it.
+func WithTags(tags ...string) RegistrationOption {
+	return registrationOptionFunc(func(r *registration) {
+		r.tags = append(r.tags, tags...)
+	})
+}
+
+// WithMiddleware wraps calls to a tool, prompt or resource with mw. The first
+// middleware is the outermost.
+func WithMiddleware(mw ...Middleware) RegistrationOption {
+	return registrationOptionFunc(func(r *registration) {
+		r.middleware = append(r.middleware, mw...)
+	})
+}
+
+type registrationOptionFunc func(r *registration)
+
+func (f registrationOptionFunc) applyToRegistration(r *registration) {
+	f(r)
+}
+
+// registration holds the options of a registered tool, prompt or resource.
+type registration struct {
+	tags       []string
+	middleware []Middleware
+	disabled   bool
+}
+
+func newRegistration(opts []RegistrationOption) registration {
+	var r registration
+	for _, opt := range opts {
+		opt.applyToRegistration(&r)
+	}
+	return r
+}
+
+// middlewareSet holds the registry-wide and tag middleware of a registry.
+type middlewareSet struct {
+	mu     sync.RWMutex
+	all    []Middleware
+	tagged []taggedMiddleware
+}
+
+type taggedMiddleware struct {
+	tag string
+	mw  Middleware
+}
+
+func (s *middlewareSet) use(mw []Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.all = append(s.all, mw...)
+}
+
+func (s *middlewareSet) useTag(tag string, mw []Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range mw {
+		s.tagged = append(s.tagged, taggedMiddleware{tag, m})
+	}
+}
+
+// invoke runs inv through the middleware that applies to an item
+// registered with reg, ending with fn.
+func (s *middlewareSet) invoke(ctx context.Context, reg registration, inv *Invocation, fn InvokeFunc) (any, error) {
+	s.mu.RLock()
+	chain := slices.Clone(s.all)
+	for _, t := range s.tagged {
+		if slices.Contains(reg.tags, t.tag) {
+			chain = append(chain, t.mw)
+		}
+	}
+	s.mu.RUnlock()
+	chain = append(chain, reg.middleware...)
+
+	inv.Tags = reg.tags
+	next := fn
+	for _, mw := range slices.Backward(chain) {
+		next = mw(next)
+	}
+	return next(ctx, inv)
+}
@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// A HandlerFunc handles requests for a single method.
+type HandlerFunc[P, R any] func(ctx context.Context, req *Request[P]) (*Response[R], error)
+
+// A NotificationFunc handles notifications for a single method.
+type NotificationFunc[P any] func(ctx context.Context, req *Request[P]) error
+
+// A Registrar accepts handlers for methods. [*Mux], [*Server] and [*Client]
+// are registrars, so [Handle] and [HandleNotification] can add handlers for
+// custom methods to either end of a connection.
+type Registrar interface {
+	register(method Method, e *muxEntry)
+}
+
+// A Mux dispatches messages to handlers registered per method. Register
+// handlers with [Handle] and [HandleNotification].
+//
+// A Mux implements [ServerHandler], so it can be passed to [NewServer] in
+// place of a type that implements every method: methods without a handler
+// are reported as unimplemented, and the server leaves their capabilities
+// out of its initialize response. Requests for methods the Mux doesn't know
+// are answered with [CodeMethodNotFound].
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[Method]*muxEntry
+}
+
+type muxEntry struct {
+	handler any
+	serve   func(ctx context.Context, b *base, msg *Message) (*Message, error)
+	// inherited marks the methods of a handler that embeds
+	// [UnimplementedServer], which may or may not be overridden.
+	inherited bool
+}
+
+func NewMux() *Mux {
+	return &Mux{handlers: map[Method]*muxEntry{}}
+}
+
+// Handle registers the handler for requests to method, replacing any
+// existing handler. It panics if method is one of the [ServerHandler]
+// methods and h doesn't take and return that method's request and response
+// types.
+//
+// Methods served by a registry passed to [WithToolRegistry],
+// [WithPromptRegistry] or [WithResourceRegistry] never reach the handler:
+// registering one on the [*Server] panics, and one already registered on
+// the server's Mux is ignored.
+func Handle[P, R any](r Registrar, method Method, h HandlerFunc[P, R]) {
+	if want, ok := handlerTypes[method]; ok && want != reflect.TypeOf(h) {
+		panic(fmt.Sprintf("mcp: handler for %s must be a %s, got %T", method, want, h))
+	}
+	r.register(method, &muxEntry{
+		handler: h,
+		serve: func(ctx context.Context, b *base, msg *Message) (*Message, error) {
+			return serveMCP(ctx, b, msg, h)
+		},
+	})
+}
+
+// HandleNotification registers the handler for notifications of method,
+// replacing any existing handler.
+func HandleNotification[P any](r Registrar, method Method, h NotificationFunc[P]) {
+	r.register(method, &muxEntry{
+		handler: h,
+		serve: func(ctx context.Context, b *base, msg *Message) (*Message, error) {
+			return serveMCP(ctx, b, msg, func(ctx context.Context, req *Request[P]) (*Response[empty], error) {
+				if err := h(ctx, req); err != nil {
+					return nil, err
+				}
+				return NewResponse(&empty{}), nil
+			})
+		},
+	})
+}
+
+func (m *Mux) register(method Method, e *muxEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlers == nil {
+		m.handlers = map[Method]*muxEntry{}
+	}
+	m.handlers[method] = e
+}
+
+func (m *Mux) lookup(method Method) (*muxEntry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.handlers[method]
+	return e, ok
+}
+
+// Handles reports whether a handler is registered for method.
+func (m *Mux) Handles(method Method) bool {
+	_, ok := m.lookup(method)
+	return ok
+}
+
+// provides reports whether a handler known to implement method is
+// registered.
+func (m *Mux) provides(method Method) bool {
+	e, ok := m.lookup(method)
+	return ok && !e.inherited
+}
+
+// Methods returns the methods with a registered handler, sorted.
+func (m *Mux) Methods() []Method {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	methods := make([]Method, 0, len(m.handlers))
+	for method := range m.handlers {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// serve dispatches msg to its handler. Requests without a handler get a
+// [CodeMethodNotFound] error; notifications without one are dropped.
+func (m *Mux) serve(ctx context.Context, b *base, msg *Message) (*Message, error) {
+	method := Method(*msg.Method)
+	e, ok := m.lookup(method)
+	if !ok {
+		if msg.ID == nil {
+			return nil, nil
+		}
+		return &Message{
+			Metadata: msg.Metadata,
+			ID:       msg.ID,
+			JsonRPC:  msg.JsonRPC,
+			Error:    errorDetail(NewError(CodeMethodNotFound, fmt.Errorf("unknown method: %s", method))),
+		}, nil
+	}
+	return e.serve(ctx, b, msg)
+}
+
+// handlerFor returns the typed handler registered for method.
+func handlerFor[P, R any](m *Mux, method Method) (HandlerFunc[P, R], bool) {
+	e, ok := m.lookup(method)
+	if !ok {
+		return nil, false
+	}
+	h, ok := e.handler.(HandlerFunc[P, R])
+	return h, ok
+}
+
+// handlerTypes holds the handler type of each method the Mux dispatches to
+// by type, so that [Handle] can catch handlers that would never be called.
+var handlerTypes = map[Method]reflect.Type{
+	MethodInitialize:            reflect.TypeFor[HandlerFunc[InitializeRequest, InitializeResponse]](),
+	MethodListTools:             reflect.TypeFor[HandlerFunc[ListToolsRequest, ListToolsResponse]](),
+	MethodCallTool:              reflect.TypeFor[HandlerFunc[CallToolRequest, CallToolResponse]](),
+	MethodListPrompts:           reflect.TypeFor[HandlerFunc[ListPromptsRequest, ListPromptsResponse]](),
+	MethodGetPrompt:             reflect.TypeFor[HandlerFunc[GetPromptRequest, GetPromptResponse]](),
+	MethodListResources:         reflect.TypeFor[HandlerFunc[ListResourcesRequest, ListResourcesResponse]](),
+	MethodReadResource:          reflect.TypeFor[HandlerFunc[ReadResourceRequest, ReadResourceResponse]](),
+	MethodListResourceTemplates: reflect.TypeFor[HandlerFunc[ListResourceTemplatesRequest, ListResourceTemplatesResponse]](),
+	MethodCompletion:            reflect.TypeFor[HandlerFunc[CompletionRequest, CompletionResponse]](),
+	MethodPing:                  reflect.TypeFor[HandlerFunc[PingRequest, PingResponse]](),
+	MethodSetLogLevel:           reflect.TypeFor[HandlerFunc[SetLogLevelRequest, SetLogLevelResponse]](),
+}
+
+// dispatch calls the handler registered for method, or returns
+// [ErrUnimplemented] if there is none.
+func dispatch[P, R any](ctx context.Context, m *Mux, method Method, req *Request[P]) (*Response[R], error) {
+	h, ok := handlerFor[P, R](m, method)
+	if !ok {
+		return nil, ErrUnimplemented
+	}
+	return h(ctx, req)
+}
+
+// handlerMux registers each method of a [ServerHandler] with a new Mux. The
+// methods of a handler that embeds [UnimplementedServer] are marked as
+// inherited: the server only derives capabilities from explicit
+// registrations, so such a handler advertises its features with
+// [WithCapabilities] or a registry.
+func handlerMux(h ServerHandler) *Mux {
+	m := NewMux()
+	Handle(m, MethodInitialize, h.Initialize)
+	Handle(m, MethodListTools, h.ListTools)
+	Handle(m, MethodCallTool, h.CallTool)
+	Handle(m, MethodListPrompts, h.ListPrompts)
+	Handle(m, MethodGetPrompt, h.GetPrompt)
+	Handle(m, MethodListResources, h.ListResources)
+	Handle(m, MethodReadResource, h.ReadResource)
+	Handle(m, MethodListResourceTemplates, h.ListResourceTemplates)
+	Handle(m, MethodCompletion, h.Completion)
+	Handle(m, MethodPing, h.Ping)
+	Handle(m, MethodSetLogLevel, h.SetLogLevel)
+	if _, ok := h.(interface{ unimplementedServer() }); ok {
+		for _, e := range m.handlers {
+			e.inherited = true
+		}
+	}
+	return m
+}
+
+func (m *Mux) Initialize(ctx context.Context, req *Request[InitializeRequest]) (*Response[InitializeResponse], error) {
+	return dispatch[InitializeRequest, InitializeResponse](ctx, m, MethodInitialize, req)
+}
+
+func (m *Mux) ListTools(ctx context.Context, req *Request[ListToolsRequest]) (*Response[ListToolsResponse], error) {
+	return dispatch[ListToolsRequest, ListToolsResponse](ctx, m, MethodListTools, req)
+}
+
+func (m *Mux) CallTool(ctx context.Context, req *Request[CallToolRequest]) (*Response[CallToolResponse], error) {
+	return dispatch[CallToolRequest, CallToolResponse](ctx, m, MethodCallTool, req)
+}
+
+func (m *Mux) ListPrompts(ctx context.Context, req *Request[ListPromptsRequest]) (*Response[ListPromptsResponse], error) {
+	return dispatch[ListPromptsRequest, ListPromptsResponse](ctx, m, MethodListPrompts, req)
+}
+
+func (m *Mux) GetPrompt(ctx context.Context, req *Request[GetPromptRequest]) (*Response[GetPromptResponse], error) {
+	return dispatch[GetPromptRequest, GetPromptResponse](ctx, m, MethodGetPrompt, req)
+}
+
+func (m *Mux) ListResources(ctx context.Context, req *Request[ListResourcesRequest]) (*Response[ListResourcesResponse], error) {
+	return dispatch[ListResourcesRequest, ListResourcesResponse](ctx, m, MethodListResources, req)
+}
+
+func (m *Mux) ReadResource(ctx context.Context, req *Request[ReadResourceRequest]) (*Response[ReadResourceResponse], error) {
+	return dispatch[ReadResourceRequest, ReadResourceResponse](ctx, m, MethodReadResource, req)
+}
+
+func (m *Mux) ListResourceTemplates(ctx context.Context, req *Request[ListResourceTemplatesRequest]) (*Response[ListResourceTemplatesResponse], error) {
+	return dispatch[ListResourceTemplatesRequest, ListResourceTemplatesResponse](ctx, m, MethodListResourceTemplates, req)
+}
+
+func (m *Mux) Completion(ctx context.Context, req *Request[CompletionRequest]) (*Response[CompletionResponse], error) {
+	return dispatch[CompletionRequest, CompletionResponse](ctx, m, MethodCompletion, req)
+}
+
+// Ping answers pings itself unless a handler is registered for
+// [MethodPing].
+func (m *Mux) Ping(ctx context.Context, req *Request[PingRequest]) (*Response[PingResponse], error) {
+	if h, ok := handlerFor[PingRequest, PingResponse](m, MethodPing); ok {
+		return h(ctx, req)
+	}
+	return NewResponse(&PingResponse{}), nil
+}
+
+func (m *Mux) SetLogLevel(ctx context.Context, req *Request[SetLogLevelRequest]) (*Response[SetLogLevelResponse], error) {
+	return dispatch[SetLogLevelRequest, SetLogLevelResponse](ctx, m, MethodSetLogLevel, req)
+}
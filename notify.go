@@ -3,8 +3,24 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 )
 
+// Notify sends a notification for method to the other end of the
+// connection. A server sends it to the session of the request being handled
+// in ctx or, outside a handler, to every session. See [Call].
+func Notify[P any](ctx context.Context, p Peer, method Method, req *Request[P]) error {
+	bs, err := p.peers(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, b := range bs {
+		errs = append(errs, notify(ctx, b, string(method), req))
+	}
+	return errors.Join(errs...)
+}
+
 func notify[P any](ctx context.Context, c *base, method string, req *Request[P]) error {
 	var interceptor Interceptor
 	if len(c.interceptors) > 0 {
@@ -38,6 +54,7 @@ func notify[P any](ctx context.Context, c *base, method string, req *Request[P])
 	})
 
 	req.method = method
+	req.outgoing = true
 
 	_, err := interceptor.WrapUnary(inner)(ctx, req)
 	if err != nil {
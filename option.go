@@ -1,5 +1,11 @@
 package mcp
 
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
 type Option interface {
 	ClientOption
 	ServerOption
@@ -28,3 +34,344 @@ func (o *interceptorsOption) applyToClient(c *Client) {
 func (o *interceptorsOption) applyToServer(s *serverConfig) {
 	s.interceptors = o.Interceptors
 }
+
+// WithToolRegistry serves tools/list and tools/call from the given registry
+// instead of the server's handler.
+func WithToolRegistry(r *ToolRegistry) ServerOption {
+	return &toolRegistryOption{r}
+}
+
+type toolRegistryOption struct {
+	registry *ToolRegistry
+}
+
+func (o *toolRegistryOption) applyToServer(s *serverConfig) {
+	s.tools = o.registry
+}
+
+// WithPromptRegistry serves prompts/list and prompts/get from the given
+// registry instead of the server's handler.
+func WithPromptRegistry(r *PromptRegistry) ServerOption {
+	return &promptRegistryOption{r}
+}
+
+type promptRegistryOption struct {
+	registry *PromptRegistry
+}
+
+func (o *promptRegistryOption) applyToServer(s *serverConfig) {
+	s.prompts = o.registry
+}
+
+// WithResourceRegistry serves resources/list, resources/templates/list and
+// resources/read from the given registry instead of the server's handler.
+func WithResourceRegistry(r *ResourceRegistry) ServerOption {
+	return &resourceRegistryOption{r}
+}
+
+type resourceRegistryOption struct {
+	registry *ResourceRegistry
+}
+
+func (o *resourceRegistryOption) applyToServer(s *serverConfig) {
+	s.resources = o.registry
+}
+
+// WithListChangedDebounce sets how long the server collects changes to its
+// registries before it sends list_changed notifications, so that a burst of
+// changes results in one notification per session and list. It defaults to
+// [DefaultListChangedDebounce].
+//
+// While the server is listening, every change to an item of its tool, prompt
+// or resource registry, including enabling or disabling it for everyone or
+// for one session, is announced with a list_changed notification to the
+// sessions whose list it changes.
+func WithListChangedDebounce(d time.Duration) ServerOption {
+	return &listChangedDebounceOption{d}
+}
+
+type listChangedDebounceOption struct {
+	d time.Duration
+}
+
+func (o *listChangedDebounceOption) applyToServer(s *serverConfig) {
+	s.listChangedDebounce = o.d
+}
+
+// WithToolArgumentValidation validates the arguments of every tools/call
+// request against the input schema of the tool in the server's
+// [ToolRegistry] before the tool is called. Arguments that don't conform are
+// rejected with [CodeInvalidParams]; the error data lists a JSON pointer and
+// message for each failing field.
+func WithToolArgumentValidation() ServerOption {
+	return &toolArgumentValidationOption{}
+}
+
+type toolArgumentValidationOption struct{}
+
+func (o *toolArgumentValidationOption) applyToServer(s *serverConfig) {
+	s.validateToolArguments = true
+}
+
+// WithToolOutputValidation checks structured tool results against the tool's
+// output schema.
+//
+// On a server, results from tools in the server's [ToolRegistry] that don't
+// conform are replaced with a [CodeInternalError] error. On a client,
+// [Client.CallTool] validates results against the output schemas returned by
+// the most recent [Client.ListTools] call and returns a [*ToolOutputError]
+// for results that don't conform.
+func WithToolOutputValidation() Option {
+	return &toolOutputValidationOption{}
+}
+
+type toolOutputValidationOption struct{}
+
+func (o *toolOutputValidationOption) applyToClient(c *Client) {
+	c.validateToolOutput = true
+}
+
+func (o *toolOutputValidationOption) applyToServer(s *serverConfig) {
+	s.validateToolOutput = true
+}
+
+// WithToolErrorResults reports errors returned by tools/call handlers to the
+// model as [ErrorResult] results instead of JSON-RPC errors, as the
+// specification recommends for failures of the tool itself, including
+// [*Error] values. Errors the SDK reports for unknown tools or invalid
+// arguments and errors from a cancelled or timed out context remain JSON-RPC
+// errors; wrap an error with [ProtocolError] to keep it a protocol error.
+func WithToolErrorResults() ServerOption {
+	return &toolErrorResultsOption{}
+}
+
+type toolErrorResultsOption struct{}
+
+func (o *toolErrorResultsOption) applyToServer(s *serverConfig) {
+	s.toolErrorResults = true
+}
+
+// WithCapabilities advertises caps in the server's initialize response. Use
+// it for capabilities that can't be derived from the handler, such as
+// listChanged for a handler without a registry, and for the features of a
+// handler that embeds [UnimplementedServer]. Capabilities set here
+// replace derived ones of the same feature, and capabilities returned by the
+// handler's Initialize method replace both.
+func WithCapabilities(caps ServerCapabilities) ServerOption {
+	return &capabilitiesOption{caps}
+}
+
+type capabilitiesOption struct {
+	caps ServerCapabilities
+}
+
+func (o *capabilitiesOption) applyToServer(s *serverConfig) {
+	s.capabilities = o.caps
+}
+
+// WithExperimentalCapability advertises a non-standard capability under the
+// experimental key of the server's initialize response or the client's
+// initialize request. A nil settings value is sent as an empty object.
+// Capabilities set explicitly by the handler or the caller take precedence.
+func WithExperimentalCapability(name string, settings json.RawMessage) Option {
+	if settings == nil {
+		settings = json.RawMessage("{}")
+	}
+	return &experimentalCapabilityOption{name, settings}
+}
+
+type experimentalCapabilityOption struct {
+	name     string
+	settings json.RawMessage
+}
+
+func (o *experimentalCapabilityOption) applyToClient(c *Client) {
+	if c.experimental == nil {
+		c.experimental = map[string]json.RawMessage{}
+	}
+	c.experimental[o.name] = o.settings
+}
+
+func (o *experimentalCapabilityOption) applyToServer(s *serverConfig) {
+	if s.experimental == nil {
+		s.experimental = map[string]json.RawMessage{}
+	}
+	s.experimental[o.name] = o.settings
+}
+
+// OnSessionStart registers a function that is called when a client
+// initializes a session, before the initialize response is sent.
+func OnSessionStart(fn func(ctx context.Context, s *Session)) ServerOption {
+	return &sessionStartOption{fn}
+}
+
+type sessionStartOption struct {
+	fn func(ctx context.Context, s *Session)
+}
+
+func (o *sessionStartOption) applyToServer(s *serverConfig) {
+	s.onSessionStart = append(s.onSessionStart, o.fn)
+}
+
+// OnSessionEnd registers a function that is called when a started session
+// ends.
+func OnSessionEnd(fn func(ctx context.Context, s *Session)) ServerOption {
+	return &sessionEndOption{fn}
+}
+
+type sessionEndOption struct {
+	fn func(ctx context.Context, s *Session)
+}
+
+func (o *sessionEndOption) applyToServer(s *serverConfig) {
+	s.onSessionEnd = append(s.onSessionEnd, o.fn)
+}
+
+// WithMaxConcurrentRequests limits the number of incoming messages the server
+// handles at once. Messages over the limit wait in a queue of the size set by
+// [WithRequestQueueSize]; while the queue is full the server stops reading
+// from the stream, which pushes back on the client. The default is no limit.
+//
+// Responses to the server's own requests are read from the same stream, so a
+// handler that waits on the client, for example with [Session.Ping], can't
+// complete while the server is pushing back. Use [WithOverloadedError] to
+// keep reading instead.
+func WithMaxConcurrentRequests(n int) ServerOption {
+	return &limitOption{func(l *limiter) { l.global = n }}
+}
+
+// WithMaxConcurrentRequestsPerSession limits the number of incoming messages
+// handled at once for each session. It combines with
+// [WithMaxConcurrentRequests].
+func WithMaxConcurrentRequestsPerSession(n int) ServerOption {
+	return &limitOption{func(l *limiter) { l.perSession = n }}
+}
+
+// WithRequestQueueSize sets how many incoming messages can wait for a slot
+// once a concurrency limit is reached. The default is zero: the server
+// pushes back as soon as it reaches a limit.
+func WithRequestQueueSize(n int) ServerOption {
+	return &limitOption{func(l *limiter) { l.queueSize = n }}
+}
+
+// WithOverloadedError answers requests that don't fit in the queue with a
+// [CodeOverloaded] error instead of pushing back on the client.
+// Notifications can't be answered, so the server still stops reading while
+// one of them doesn't fit.
+func WithOverloadedError() ServerOption {
+	return &limitOption{func(l *limiter) { l.reject = true }}
+}
+
+type limitOption struct {
+	apply func(l *limiter)
+}
+
+func (o *limitOption) applyToServer(s *serverConfig) {
+	if s.limiter == nil {
+		s.limiter = newLimiter()
+	}
+	o.apply(s.limiter)
+}
+
+// WithSequentialProcessing handles incoming messages from a peer one at a
+// time, in the order they were received, so stateful handlers can rely on
+// message order. On a server, each session is ordered independently.
+//
+// A handler that waits on the peer, for example for a response to a request
+// the handler sent, can still complete: responses are not ordered.
+func WithSequentialProcessing() Option {
+	return &orderingOption{orderSequential}
+}
+
+// WithOrderedNotifications handles each incoming notification only after
+// every message received before it has started and every notification
+// received before it has finished, and starts each request only after
+// earlier notifications have finished. Requests still run concurrently with
+// each other. On a server, each session is ordered independently.
+func WithOrderedNotifications() Option {
+	return &orderingOption{orderNotifications}
+}
+
+type orderingOption struct {
+	ordering ordering
+}
+
+func (o *orderingOption) applyToClient(c *Client) {
+	c.ordering = o.ordering
+}
+
+func (o *orderingOption) applyToServer(s *serverConfig) {
+	s.ordering = o.ordering
+}
+
+// WithCallTimeout bounds how long a call waits for the peer's response when
+// the caller's context has no earlier deadline. A call that times out fails
+// with [CodeRequestTimeout], and the peer is sent a cancellation
+// notification so it can stop working on the request. Use
+// [WithMethodCallTimeout] to override the timeout for a method.
+func WithCallTimeout(d time.Duration) Option {
+	return &callTimeoutOption{d: d}
+}
+
+// WithMethodCallTimeout bounds calls of method, replacing the timeout set by
+// [WithCallTimeout]. A zero duration disables the timeout for method.
+func WithMethodCallTimeout(method Method, d time.Duration) Option {
+	return &callTimeoutOption{method: method, d: d}
+}
+
+type callTimeoutOption struct {
+	method Method
+	d      time.Duration
+}
+
+func (o *callTimeoutOption) applyToClient(c *Client) {
+	c.callTimeouts.set(o.method, o.d)
+}
+
+func (o *callTimeoutOption) applyToServer(s *serverConfig) {
+	s.callTimeouts.set(o.method, o.d)
+}
+
+// WithHandlerTimeout puts a deadline on the context of every request
+// handler. A handler that fails once its deadline has passed is reported to
+// the client with [CodeRequestTimeout]. Use [WithMethodHandlerTimeout] to
+// override the timeout for a method, for example to give tools/call longer.
+func WithHandlerTimeout(d time.Duration) ServerOption {
+	return &handlerTimeoutOption{d: d}
+}
+
+// WithMethodHandlerTimeout puts a deadline on the context of handlers for
+// method, replacing the timeout set by [WithHandlerTimeout]. A zero duration
+// disables the timeout for method.
+func WithMethodHandlerTimeout(method Method, d time.Duration) ServerOption {
+	return &handlerTimeoutOption{method: method, d: d}
+}
+
+type handlerTimeoutOption struct {
+	method Method
+	d      time.Duration
+}
+
+func (o *handlerTimeoutOption) applyToServer(s *serverConfig) {
+	s.handlerTimeouts.set(o.method, o.d)
+}
+
+// WithPanicHandler sets the function that reports panics recovered from
+// handlers. A panicking request handler is answered with a
+// [CodeInternalError] error; the connection and other requests are
+// unaffected. By default panics are logged with the standard logger.
+func WithPanicHandler(h PanicHandler) Option {
+	return &panicHandlerOption{h}
+}
+
+type panicHandlerOption struct {
+	h PanicHandler
+}
+
+func (o *panicHandlerOption) applyToClient(c *Client) {
+	c.onPanic = o.h
+}
+
+func (o *panicHandlerOption) applyToServer(s *serverConfig) {
+	s.onPanic = o.h
+}
@@ -0,0 +1,80 @@
+package mcp
+
+import "sync"
+
+// ordering controls the order in which incoming messages from one peer are
+// handled.
+type ordering int
+
+const (
+	// orderNone handles every message in its own goroutine as soon as it
+	// arrives.
+	orderNone ordering = iota
+	// orderNotifications handles a notification only once every earlier
+	// message has started and every earlier notification has finished.
+	// Requests still run concurrently with each other.
+	orderNotifications
+	// orderSequential handles one message at a time, in the order received.
+	orderSequential
+)
+
+// sequencer chains the messages of each session so that they are handled in
+// the order set by mode. Sessions are ordered independently of each other.
+type sequencer struct {
+	mode ordering
+
+	mu    sync.Mutex
+	tails map[string]chan struct{} // closed when the last message may be followed
+}
+
+func newSequencer(mode ordering) *sequencer {
+	if mode == orderNone {
+		return nil
+	}
+	return &sequencer{mode: mode, tails: map[string]chan struct{}{}}
+}
+
+// wrap returns a function that waits for the message received before this
+// one in the same session, then calls run, and a function to call instead if
+// the message is dropped. It must be called in the order messages are
+// received.
+func (s *sequencer) wrap(session string, notification bool, run func()) (func(), func()) {
+	if s == nil {
+		return run, func() {}
+	}
+	ready := make(chan struct{})
+	s.mu.Lock()
+	prev := s.tails[session]
+	s.tails[session] = ready
+	s.mu.Unlock()
+
+	release := func() {
+		close(ready)
+		s.mu.Lock()
+		if s.tails[session] == ready {
+			delete(s.tails, session)
+		}
+		s.mu.Unlock()
+	}
+	wait := func() {
+		if prev != nil {
+			<-prev
+		}
+	}
+	ordered := func() {
+		wait()
+		if notification || s.mode == orderSequential {
+			defer release()
+		} else {
+			release()
+		}
+		run()
+	}
+	drop := func() {
+		go func() {
+			wait()
+			release()
+		}()
+	}
+	return ordered, drop
+}
@@ -0,0 +1,289 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// A PromptRenderer produces the messages of a prompt from its arguments.
+type PromptRenderer interface {
+	RenderPrompt(ctx context.Context, args map[string]string) ([]PromptMessage, error)
+}
+
+// PromptFunc adapts a function to a [PromptRenderer].
+type PromptFunc func(ctx context.Context, args map[string]string) ([]PromptMessage, error)
+
+func (f PromptFunc) RenderPrompt(ctx context.Context, args map[string]string) ([]PromptMessage, error) {
+	return f(ctx, args)
+}
+
+// TextMessage returns a prompt message with text content.
+func TextMessage(role, text string) PromptMessage {
+	return PromptMessage{Role: role, Content: Content{Type: "text", Text: text}}
+}
+
+// ResourceMessage returns a prompt message that embeds a resource.
+func ResourceMessage(role string, resource ResourceContent) PromptMessage {
+	return PromptMessage{Role: role, Content: Content{Type: "resource", Resource: &resource}}
+}
+
+// A MessageTemplate describes one message of a [PromptTemplate]. Text is a
+// text/template executed with the prompt's arguments as data, so an argument
+// named "topic" is written {{.topic}}. Missing optional arguments render as
+// the empty string.
+//
+// If Resource is set, the message embeds that resource instead of text; its
+// URI and Text are templates as well.
+type MessageTemplate struct {
+	Role     string
+	Text     string
+	Resource *ResourceContent
+}
+
+// A PromptTemplate is a [PromptRenderer] built from text/template sources.
+type PromptTemplate struct {
+	messages []compiledMessage
+}
+
+type compiledMessage struct {
+	role     string
+	text     *template.Template
+	resource *ResourceContent
+	uri      *template.Template
+}
+
+// NewPromptTemplate parses the message templates of a prompt.
+func NewPromptTemplate(messages ...MessageTemplate) (*PromptTemplate, error) {
+	pt := &PromptTemplate{}
+	for i, m := range messages {
+		cm := compiledMessage{role: m.Role, resource: m.Resource}
+		text := m.Text
+		if m.Resource != nil {
+			text = m.Resource.Text
+			uri, err := parseMessageTemplate(fmt.Sprintf("message %d uri", i), m.Resource.URI)
+			if err != nil {
+				return nil, err
+			}
+			cm.uri = uri
+		}
+		t, err := parseMessageTemplate(fmt.Sprintf("message %d", i), text)
+		if err != nil {
+			return nil, err
+		}
+		cm.text = t
+		pt.messages = append(pt.messages, cm)
+	}
+	return pt, nil
+}
+
+func parseMessageTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+func (pt *PromptTemplate) RenderPrompt(ctx context.Context, args map[string]string) ([]PromptMessage, error) {
+	msgs := make([]PromptMessage, 0, len(pt.messages))
+	for _, m := range pt.messages {
+		text, err := execute(m.text, args)
+		if err != nil {
+			return nil, err
+		}
+		if m.resource == nil {
+			msgs = append(msgs, TextMessage(m.role, text))
+			continue
+		}
+		uri, err := execute(m.uri, args)
+		if err != nil {
+			return nil, err
+		}
+		resource := *m.resource
+		resource.URI = uri
+		resource.Text = text
+		msgs = append(msgs, ResourceMessage(m.role, resource))
+	}
+	return msgs, nil
+}
+
+func execute(t *template.Template, args map[string]string) (string, error) {
+	if args == nil {
+		args = map[string]string{}
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, args); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// A PromptRegistry serves prompts/list and prompts/get from a set of prompts.
+// Register prompts with [PromptRegistry.AddPrompt] and pass the registry to a
+// server with [WithPromptRegistry].
+//
+// Like tools, prompts can be added, removed, enabled and disabled while the
+// server runs, and sessions whose list of prompts changes are sent a
+// prompts/list_changed notification. See [ToolRegistry].
+type PromptRegistry struct {
+	mu         sync.RWMutex
+	prompts    []*registeredPrompt
+	middleware middlewareSet
+	list       listState
+}
+
+type registeredPrompt struct {
+	prompt       Prompt
+	renderer     PromptRenderer
+	registration registration
+}
+
+func NewPromptRegistry() *PromptRegistry {
+	return &PromptRegistry{}
+}
+
+// AddPrompt registers a prompt with the registry, replacing any prompt with
+// the same name. The renderer is only called once every argument marked as
+// required in prompt.Arguments is present. Options attach tags and
+// [Middleware] to the prompt; the prompt is enabled unless [WithDisabled] is
+// given.
+func (r *PromptRegistry) AddPrompt(prompt Prompt, renderer PromptRenderer, opts ...RegistrationOption) {
+	p := &registeredPrompt{prompt: prompt, renderer: renderer, registration: newRegistration(opts)}
+	r.update(prompt.Name, func() bool {
+		r.list.visibility.setDisabled(prompt.Name, p.registration.disabled)
+		if i := r.index(prompt.Name); i >= 0 {
+			r.prompts[i] = p
+			return true
+		}
+		r.prompts = append(r.prompts, p)
+		return false
+	})
+}
+
+// RemovePrompt removes the named prompt from the registry.
+func (r *PromptRegistry) RemovePrompt(name string) {
+	r.update(name, func() bool {
+		if i := r.index(name); i >= 0 {
+			r.prompts = slices.Delete(r.prompts, i, i+1)
+		}
+		r.list.visibility.remove(name)
+		return false
+	})
+}
+
+// EnablePrompt shows the named prompt to every session, except those it was
+// disabled for with [PromptRegistry.DisablePromptFor].
+func (r *PromptRegistry) EnablePrompt(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, false)
+		return false
+	})
+}
+
+// DisablePrompt hides the named prompt from every session, except those it
+// was enabled for with [PromptRegistry.EnablePromptFor].
+func (r *PromptRegistry) DisablePrompt(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, true)
+		return false
+	})
+}
+
+// EnablePromptFor shows the named prompt to one session, whether or not it
+// is enabled for the others. Sessions that have ended are ignored.
+func (r *PromptRegistry) EnablePromptFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, true)
+		return false
+	})
+}
+
+// DisablePromptFor hides the named prompt from one session, whether or not
+// it is enabled for the others.
+func (r *PromptRegistry) DisablePromptFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, false)
+		return false
+	})
+}
+
+func (r *PromptRegistry) update(name string, fn func() bool) {
+	r.list.update(&r.mu, name, func() bool { return r.index(name) >= 0 }, fn)
+}
+
+// index returns the position of the named prompt, or -1. The caller must
+// hold r.mu.
+func (r *PromptRegistry) index(name string) int {
+	return slices.IndexFunc(r.prompts, func(p *registeredPrompt) bool {
+		return p.prompt.Name == name
+	})
+}
+
+// lookupFor returns the named prompt if the session of ctx can see it.
+func (r *PromptRegistry) lookupFor(ctx context.Context, name string) (*registeredPrompt, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.index(name); i >= 0 && r.list.visibility.visible(SessionFromContext(ctx), name) {
+		return r.prompts[i], true
+	}
+	return nil, false
+}
+
+// ListPrompts returns the prompts the session can see in registration order.
+func (r *PromptRegistry) ListPrompts(ctx context.Context, req *Request[ListPromptsRequest]) (*Response[ListPromptsResponse], error) {
+	sess := SessionFromContext(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	prompts := make([]Prompt, 0, len(r.prompts))
+	for _, p := range r.prompts {
+		if r.list.visibility.visible(sess, p.prompt.Name) {
+			prompts = append(prompts, p.prompt)
+		}
+	}
+	return NewResponse(&ListPromptsResponse{
+		Prompts: prompts,
+	}), nil
+}
+
+// GetPrompt renders the named prompt. Unknown and disabled prompts and
+// missing required arguments are reported as invalid params.
+func (r *PromptRegistry) GetPrompt(ctx context.Context, req *Request[GetPromptRequest]) (*Response[GetPromptResponse], error) {
+	p, ok := r.lookupFor(ctx, req.Params.Name)
+	if !ok {
+		return nil, NewError(CodeInvalidParams, fmt.Errorf("unknown prompt: %s", req.Params.Name))
+	}
+	for _, arg := range p.prompt.Arguments {
+		if _, ok := req.Params.Arguments[arg.Name]; arg.Required && !ok {
+			return nil, NewError(CodeInvalidParams, fmt.Errorf("missing required argument %s for prompt %s", arg.Name, p.prompt.Name))
+		}
+	}
+	inv := &Invocation{Kind: PromptInvocation, Name: p.prompt.Name, Args: req.Params.Arguments, Request: req}
+	result, err := r.middleware.invoke(ctx, p.registration, inv, func(ctx context.Context, inv *Invocation) (any, error) {
+		args, ok := inv.Args.(map[string]string)
+		if !ok {
+			return nil, NewError(CodeInternalError, fmt.Errorf("middleware replaced arguments for prompt %s with %T", p.prompt.Name, inv.Args))
+		}
+		return p.renderer.RenderPrompt(ctx, args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	msgs, ok := result.([]PromptMessage)
+	if !ok {
+		return nil, NewError(CodeInternalError, fmt.Errorf("middleware returned %T for prompt %s", result, p.prompt.Name))
+	}
+	return NewResponse(&GetPromptResponse{
+		Description: p.prompt.Description,
+		Messages:    msgs,
+	}), nil
+}
+
+// Use adds middleware that wraps every prompt in the registry.
+func (r *PromptRegistry) Use(mw ...Middleware) {
+	r.middleware.use(mw)
+}
+
+// UseTag adds middleware that wraps every prompt tagged with tag.
+func (r *PromptRegistry) UseTag(tag string, mw ...Middleware) {
+	r.middleware.useTag(tag, mw)
+}
@@ -0,0 +1,237 @@
+// Package ratelimit throttles MCP requests and notifications with token
+// buckets.
+//
+// A [Limiter] is an [mcp.Interceptor]. Each limit takes a [KeyFunc] that
+// picks the bucket a message counts against, such as its session, a
+// metadata header or the tool it calls. Requests over a limit fail with
+// [CodeRateLimited] and a retry-after hint; notifications over a limit are
+// dropped.
+//
+//	limiter := ratelimit.New(
+//		ratelimit.WithRequestLimit(ratelimit.PerSecond(10, 20), ratelimit.BySession()),
+//		ratelimit.WithRequestLimit(ratelimit.PerMinute(5, 5), ratelimit.Join(ratelimit.BySession(), ratelimit.ByTool("export"))),
+//		ratelimit.WithNotificationLimit(ratelimit.PerSecond(50, 100), ratelimit.BySession()),
+//	)
+//	server := mcp.NewServer(stream, handler, mcp.WithInterceptors(limiter))
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+// CodeRateLimited is the JSON-RPC error code of a request rejected by a
+// [Limiter]. The error's data is an [ErrorData].
+const CodeRateLimited = -32004
+
+// ErrorData is the data of a [CodeRateLimited] error.
+type ErrorData struct {
+	// RetryAfter is the number of seconds to wait before retrying.
+	RetryAfter float64 `json:"retryAfter"`
+}
+
+// RetryAfter returns how long to wait before retrying a request that failed
+// with err, if err is a [CodeRateLimited] error.
+func RetryAfter(err error) (time.Duration, bool) {
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != CodeRateLimited {
+		return 0, false
+	}
+	var data ErrorData
+	switch d := rpcErr.Data().(type) {
+	case ErrorData:
+		data = d
+	case json.RawMessage:
+		if json.Unmarshal(d, &data) != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return time.Duration(data.RetryAfter * float64(time.Second)), true
+}
+
+// A Limit is the rate at which a bucket refills, in tokens per second, and
+// the number of tokens it holds when full.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerSecond returns a limit of n messages a second with bursts of burst.
+func PerSecond(n float64, burst int) Limit {
+	return Limit{Rate: n, Burst: burst}
+}
+
+// PerMinute returns a limit of n messages a minute with bursts of burst.
+func PerMinute(n float64, burst int) Limit {
+	return Limit{Rate: n / 60, Burst: burst}
+}
+
+// A KeyFunc returns the bucket a message counts against. Messages for which
+// it returns the empty string aren't limited.
+type KeyFunc func(ctx context.Context, req mcp.AnyRequest) string
+
+// BySession keys messages by the session they belong to.
+func BySession() KeyFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) string {
+		if s := mcp.SessionFromContext(ctx); s != nil {
+			return s.ID()
+		}
+		return req.Metadata()["session_id"]
+	}
+}
+
+// ByMetadata keys messages by a metadata value, such as an HTTP header set by
+// the sse transport. Messages without it aren't limited.
+func ByMetadata(key string) KeyFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) string {
+		return req.Metadata()[key]
+	}
+}
+
+// ByMethod keys messages by their method.
+func ByMethod() KeyFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) string {
+		return req.Method()
+	}
+}
+
+// ByTool keys tools/call requests by the name of the tool. If names are
+// given, only calls to those tools are limited. Other messages aren't
+// limited.
+func ByTool(names ...string) KeyFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) string {
+		call, ok := req.Any().(*mcp.CallToolRequest)
+		if !ok {
+			return ""
+		}
+		if len(names) > 0 && !slices.Contains(names, call.Name) {
+			return ""
+		}
+		return call.Name
+	}
+}
+
+// Join keys messages by every key, so that each combination has its own
+// bucket. Messages for which any key is empty aren't limited.
+func Join(keys ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) string {
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			if parts[i] = key(ctx, req); parts[i] == "" {
+				return ""
+			}
+			parts[i] = strconv.Quote(parts[i])
+		}
+		return strings.Join(parts, ",")
+	}
+}
+
+// A Limiter is an [mcp.Interceptor] that enforces rate limits on the messages
+// a server or client receives. Messages it sends, such as a server's own
+// notifications, pass through unlimited.
+type Limiter struct {
+	store         Store
+	now           func() time.Time
+	requests      []rule
+	notifications []rule
+}
+
+type rule struct {
+	name  string
+	limit Limit
+	key   KeyFunc
+}
+
+type Option interface {
+	apply(l *Limiter)
+}
+
+type optionFunc func(l *Limiter)
+
+func (f optionFunc) apply(l *Limiter) {
+	f(l)
+}
+
+// WithRequestLimit limits requests by key. Every request limit applies; a
+// request must fit in each of them.
+func WithRequestLimit(limit Limit, key KeyFunc) Option {
+	return optionFunc(func(l *Limiter) {
+		l.requests = append(l.requests, rule{fmt.Sprintf("request/%d", len(l.requests)), limit, key})
+	})
+}
+
+// WithNotificationLimit limits notifications by key. Every notification
+// limit applies.
+func WithNotificationLimit(limit Limit, key KeyFunc) Option {
+	return optionFunc(func(l *Limiter) {
+		l.notifications = append(l.notifications, rule{fmt.Sprintf("notification/%d", len(l.notifications)), limit, key})
+	})
+}
+
+// WithStore keeps buckets in s instead of in memory. Limiters configured
+// with the same limits in the same order share buckets in a shared store.
+func WithStore(s Store) Option {
+	return optionFunc(func(l *Limiter) {
+		l.store = s
+	})
+}
+
+func New(opts ...Option) *Limiter {
+	l := &Limiter{now: time.Now}
+	for _, opt := range opts {
+		opt.apply(l)
+	}
+	if l.store == nil {
+		l.store = NewMemoryStore()
+	}
+	return l
+}
+
+func (l *Limiter) WrapUnary(next mcp.UnaryFunc) mcp.UnaryFunc {
+	return func(ctx context.Context, req mcp.AnyRequest) (mcp.AnyResponse, error) {
+		if req.Outgoing() {
+			return next(ctx, req)
+		}
+		rules := l.requests
+		if req.ID() == "" {
+			rules = l.notifications
+		}
+		if err := l.take(ctx, req, rules); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+// take takes a token from the bucket of each rule that applies to req, or
+// none if any of them is empty.
+func (l *Limiter) take(ctx context.Context, req mcp.AnyRequest, rules []rule) error {
+	var buckets []Bucket
+	for _, r := range rules {
+		if key := r.key(ctx, req); key != "" {
+			buckets = append(buckets, Bucket{Key: r.name + ":" + key, Limit: r.limit})
+		}
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+	ok, wait, err := l.store.Take(ctx, buckets, l.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return mcp.NewError(CodeRateLimited, fmt.Errorf("rate limit exceeded for %s", req.Method())).
+			WithData(ErrorData{RetryAfter: wait.Seconds()})
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	limit := PerSecond(2, 3)
+	now := time.Now()
+
+	for i := range 3 {
+		if ok, _, _ := s.Take(ctx, []Bucket{{"a", limit}}, now); !ok {
+			t.Fatalf("take %d: expected a token from the burst", i)
+		}
+	}
+	ok, wait, _ := s.Take(ctx, []Bucket{{"a", limit}}, now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got ok=%v wait=%v", ok, wait)
+	}
+	if ok, _, _ := s.Take(ctx, []Bucket{{"b", limit}}, now); !ok {
+		t.Fatal("expected buckets to be independent")
+	}
+	if ok, _, _ := s.Take(ctx, []Bucket{{"a", limit}}, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("expected a token after refilling")
+	}
+
+	s.Take(ctx, []Bucket{{"c", limit}}, now)
+	s.sweep(now.Add(2 * time.Second))
+	if len(s.buckets) != 0 {
+		t.Fatalf("expected full buckets to be swept, got %d", len(s.buckets))
+	}
+}
+
+func TestMemoryStoreAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	wide, narrow := Bucket{"wide", PerSecond(1, 5)}, Bucket{"narrow", PerSecond(1, 1)}
+
+	if ok, _, _ := s.Take(ctx, []Bucket{wide, narrow}, now); !ok {
+		t.Fatal("expected a token from both buckets")
+	}
+	if ok, _, _ := s.Take(ctx, []Bucket{wide, narrow}, now); ok {
+		t.Fatal("expected the narrow bucket to be empty")
+	}
+	if got := s.buckets["wide"].tokens; got != 4 {
+		t.Fatalf("expected the rejected take to leave the wide bucket alone, got %v tokens", got)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	call := mcp.NewRequest(&mcp.CallToolRequest{Name: "export"})
+	for _, tc := range []struct {
+		name string
+		key  KeyFunc
+		want string
+	}{
+		{"tool", ByTool(), "export"},
+		{"listed tool", ByTool("export", "import"), "export"},
+		{"other tool", ByTool("import"), ""},
+		{"missing metadata", ByMetadata("Authorization"), ""},
+		{"join with empty", Join(ByTool(), ByMetadata("Authorization")), ""},
+		{"join", Join(ByTool(), ByTool()), `"export","export"`},
+	} {
+		if got := tc.key(ctx, call); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// A Store keeps token buckets. Implement it on top of a shared database to
+// apply limits across several servers. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Take removes a token from each of the buckets, which refill at their
+	// limits and start full, if every one of them has a token. Otherwise it
+	// takes nothing and reports false and how long until they all have one.
+	Take(ctx context.Context, buckets []Bucket, now time.Time) (ok bool, retryAfter time.Duration, err error)
+}
+
+// A Bucket names a token bucket and the limit it refills at.
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// MemoryStore is a [Store] that keeps buckets in memory. Buckets that have
+// refilled completely are forgotten.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, buckets []Bucket, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) > time.Minute {
+		s.sweep(now)
+	}
+	bs := make([]*bucket, len(buckets))
+	var wait time.Duration
+	for i, bk := range buckets {
+		b, ok := s.buckets[bk.Key]
+		if !ok {
+			b = &bucket{tokens: float64(bk.Limit.Burst), last: now, limit: bk.Limit}
+			s.buckets[bk.Key] = b
+		}
+		b.refill(now)
+		bs[i] = b
+		if b.tokens >= 1 {
+			continue
+		}
+		if bk.Limit.Rate <= 0 {
+			wait = time.Duration(math.MaxInt64)
+		} else {
+			wait = max(wait, time.Duration((1-b.tokens)/bk.Limit.Rate*float64(time.Second)))
+		}
+	}
+	if wait > 0 {
+		return false, wait, nil
+	}
+	for _, b := range bs {
+		b.tokens--
+	}
+	return true, 0, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.Rate)
+		b.last = now
+	}
+}
+
+// sweep forgets buckets that are full again. s.mu must be held.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	s.swept = now
+}
@@ -0,0 +1,67 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+)
+
+// A PanicHandler is called with the value and stack trace of a panic
+// recovered while handling a message for method.
+type PanicHandler func(ctx context.Context, method string, v any, stack []byte)
+
+// logPanic is the default PanicHandler.
+func logPanic(ctx context.Context, method string, v any, stack []byte) {
+	log.Printf("mcp: panic handling %s: %v\n%s", method, v, stack)
+}
+
+// errPanic is sent to the peer in place of a request whose handler panicked.
+// The panic value isn't sent, as it may reveal internal details.
+var errPanic = NewError(CodeInternalError, errors.New("internal error"))
+
+// RecoverInterceptor returns an interceptor that recovers panics in the
+// functions it wraps, reports them to h and turns them into a
+// [CodeInternalError] error. A nil h logs panics with the standard logger.
+//
+// Clients and servers already recover panics in handlers; the interceptor
+// lets an interceptor stack report and convert them before later
+// interceptors see the result.
+func RecoverInterceptor(h PanicHandler) Interceptor {
+	if h == nil {
+		h = logPanic
+	}
+	return UnaryInterceptorFunc(func(next UnaryFunc) UnaryFunc {
+		return func(ctx context.Context, req AnyRequest) (resp AnyResponse, err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					h(ctx, req.Method(), v, debug.Stack())
+					resp, err = nil, errPanic
+				}
+			}()
+			return next(ctx, req)
+		}
+	})
+}
+
+// recoverHandler recovers a panic while handling msg, reports it and, for a
+// request, answers it with a [CodeInternalError] error. It must be deferred.
+func (b *base) recoverHandler(ctx context.Context, msg *Message) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	h := b.onPanic
+	if h == nil {
+		h = logPanic
+	}
+	h(ctx, *msg.Method, v, debug.Stack())
+	if msg.ID != nil {
+		b.reply(ctx, *msg.Method, &Message{
+			Metadata: msg.Metadata,
+			ID:       msg.ID,
+			JsonRPC:  msg.JsonRPC,
+			Error:    errorDetail(errPanic),
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/riza-io/mcp-go/uritemplate"
+)
+
+// ResourceFunc reads a static resource.
+type ResourceFunc func(ctx context.Context, uri string) ([]ResourceContent, error)
+
+// ResourceTemplateFunc reads a resource matched by a URI template. vars holds
+// the values of the template's variables extracted from the requested URI.
+type ResourceTemplateFunc func(ctx context.Context, uri string, vars map[string]string) ([]ResourceContent, error)
+
+// A ResourceRegistry serves resources/list, resources/templates/list and
+// resources/read from a set of static resources and URI templates. Register
+// resources with [ResourceRegistry.AddResource] and
+// [ResourceRegistry.AddResourceTemplate] and pass the registry to a server
+// with [WithResourceRegistry].
+//
+// Like tools, resources and templates can be added, removed, enabled and
+// disabled while the server runs, and sessions whose list of resources or
+// templates changes are sent a resources/list_changed notification. See
+// [ToolRegistry]. Resources are named by their URI and templates by their
+// URI template.
+type ResourceRegistry struct {
+	mu         sync.RWMutex
+	resources  []*registeredResource
+	templates  []*registeredTemplate
+	middleware middlewareSet
+	list       listState
+}
+
+type registeredResource struct {
+	resource     Resource
+	read         ResourceFunc
+	registration registration
+}
+
+type registeredTemplate struct {
+	template     ResourceTemplate
+	parsed       *uritemplate.Template
+	read         ResourceTemplateFunc
+	registration registration
+}
+
+func NewResourceRegistry() *ResourceRegistry {
+	return &ResourceRegistry{}
+}
+
+// AddResource registers a static resource, replacing any resource with the
+// same URI. Options attach tags and [Middleware] to the resource; the
+// resource is enabled unless [WithDisabled] is given.
+func (r *ResourceRegistry) AddResource(resource Resource, read ResourceFunc, opts ...RegistrationOption) {
+	res := &registeredResource{resource: resource, read: read, registration: newRegistration(opts)}
+	r.update(resource.URI, func() bool {
+		r.list.visibility.setDisabled(resource.URI, res.registration.disabled)
+		if i := r.resourceIndex(resource.URI); i >= 0 {
+			r.resources[i] = res
+			return true
+		}
+		r.resources = append(r.resources, res)
+		return false
+	})
+}
+
+// AddResourceTemplate registers a resource template, replacing any template
+// with the same URI template. It panics if template.URITemplate is not a
+// valid RFC 6570 template.
+//
+// A read of a URI that doesn't match a static resource is passed to the first
+// registered template that matches it. Options attach tags and [Middleware]
+// to the template; the template is enabled unless [WithDisabled] is given.
+func (r *ResourceRegistry) AddResourceTemplate(template ResourceTemplate, read ResourceTemplateFunc, opts ...RegistrationOption) {
+	parsed, err := uritemplate.Parse(template.URITemplate)
+	if err != nil {
+		panic(fmt.Sprintf("mcp: resource template %s: %v", template.Name, err))
+	}
+	t := &registeredTemplate{template: template, parsed: parsed, read: read, registration: newRegistration(opts)}
+	r.update(template.URITemplate, func() bool {
+		r.list.visibility.setDisabled(template.URITemplate, t.registration.disabled)
+		if i := r.templateIndex(template.URITemplate); i >= 0 {
+			r.templates[i] = t
+			return true
+		}
+		r.templates = append(r.templates, t)
+		return false
+	})
+}
+
+// RemoveResource removes the resource with the given URI, or the template
+// with the given URI template, from the registry.
+func (r *ResourceRegistry) RemoveResource(name string) {
+	r.update(name, func() bool {
+		if i := r.resourceIndex(name); i >= 0 {
+			r.resources = slices.Delete(r.resources, i, i+1)
+		}
+		if i := r.templateIndex(name); i >= 0 {
+			r.templates = slices.Delete(r.templates, i, i+1)
+		}
+		r.list.visibility.remove(name)
+		return false
+	})
+}
+
+// EnableResource shows the named resource or template to every session,
+// except those it was disabled for with [ResourceRegistry.DisableResourceFor].
+func (r *ResourceRegistry) EnableResource(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, false)
+		return false
+	})
+}
+
+// DisableResource hides the named resource or template from every session,
+// except those it was enabled for with [ResourceRegistry.EnableResourceFor].
+// Reads of a disabled resource are reported with [CodeResourceNotFound].
+func (r *ResourceRegistry) DisableResource(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, true)
+		return false
+	})
+}
+
+// EnableResourceFor shows the named resource or template to one session,
+// whether or not it is enabled for the others. Sessions that have ended are
+// ignored.
+func (r *ResourceRegistry) EnableResourceFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, true)
+		return false
+	})
+}
+
+// DisableResourceFor hides the named resource or template from one session,
+// whether or not it is enabled for the others.
+func (r *ResourceRegistry) DisableResourceFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, false)
+		return false
+	})
+}
+
+func (r *ResourceRegistry) update(name string, fn func() bool) {
+	r.list.update(&r.mu, name, func() bool {
+		return r.resourceIndex(name) >= 0 || r.templateIndex(name) >= 0
+	}, fn)
+}
+
+// resourceIndex returns the position of the static resource with the given
+// URI, or -1. The caller must hold r.mu.
+func (r *ResourceRegistry) resourceIndex(uri string) int {
+	return slices.IndexFunc(r.resources, func(res *registeredResource) bool {
+		return res.resource.URI == uri
+	})
+}
+
+// templateIndex returns the position of the template with the given URI
+// template, or -1. The caller must hold r.mu.
+func (r *ResourceRegistry) templateIndex(uriTemplate string) int {
+	return slices.IndexFunc(r.templates, func(t *registeredTemplate) bool {
+		return t.template.URITemplate == uriTemplate
+	})
+}
+
+// ListResources returns the static resources the session can see in
+// registration order.
+func (r *ResourceRegistry) ListResources(ctx context.Context, req *Request[ListResourcesRequest]) (*Response[ListResourcesResponse], error) {
+	sess := SessionFromContext(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	resources := make([]Resource, 0, len(r.resources))
+	for _, res := range r.resources {
+		if r.list.visibility.visible(sess, res.resource.URI) {
+			resources = append(resources, res.resource)
+		}
+	}
+	return NewResponse(&ListResourcesResponse{
+		Resources: resources,
+	}), nil
+}
+
+// ListResourceTemplates returns the resource templates the session can see
+// in registration order.
+func (r *ResourceRegistry) ListResourceTemplates(ctx context.Context, req *Request[ListResourceTemplatesRequest]) (*Response[ListResourceTemplatesResponse], error) {
+	sess := SessionFromContext(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	templates := make([]ResourceTemplate, 0, len(r.templates))
+	for _, t := range r.templates {
+		if r.list.visibility.visible(sess, t.template.URITemplate) {
+			templates = append(templates, t.template)
+		}
+	}
+	return NewResponse(&ListResourceTemplatesResponse{
+		Templates: templates,
+	}), nil
+}
+
+// ReadResource reads the static resource with the requested URI or, failing
+// that, the first template that matches it. URIs that match neither are
+// reported with [CodeResourceNotFound].
+func (r *ResourceRegistry) ReadResource(ctx context.Context, req *Request[ReadResourceRequest]) (*Response[ReadResourceResponse], error) {
+	uri := req.Params.URI
+	contents, err := r.read(ctx, uri, req)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(&ReadResourceResponse{
+		Contents: contents,
+	}), nil
+}
+
+func (r *ResourceRegistry) read(ctx context.Context, uri string, req AnyRequest) ([]ResourceContent, error) {
+	inv := &Invocation{Kind: ResourceInvocation, URI: uri, Request: req}
+	var reg registration
+	var read InvokeFunc
+	sess := SessionFromContext(ctx)
+	r.mu.RLock()
+	static := false
+	for _, res := range r.resources {
+		if res.resource.URI != uri {
+			continue
+		}
+		// A hidden resource doesn't fall through to a template that
+		// matches its URI.
+		static = true
+		if r.list.visibility.visible(sess, uri) {
+			inv.Name, reg = uri, res.registration
+			read = func(ctx context.Context, inv *Invocation) (any, error) {
+				return res.read(ctx, inv.URI)
+			}
+		}
+		break
+	}
+	if !static {
+		for _, t := range r.templates {
+			if !r.list.visibility.visible(sess, t.template.URITemplate) {
+				continue
+			}
+			if vars, ok := t.parsed.Match(uri); ok {
+				inv.Name, inv.Args, reg = t.template.URITemplate, vars, t.registration
+				read = func(ctx context.Context, inv *Invocation) (any, error) {
+					vars, ok := inv.Args.(map[string]string)
+					if !ok {
+						return nil, NewError(CodeInternalError, fmt.Errorf("middleware replaced variables for resource %s with %T", uri, inv.Args))
+					}
+					return t.read(ctx, inv.URI, vars)
+				}
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+	if read == nil {
+		return nil, ResourceNotFound(uri)
+	}
+	result, err := r.middleware.invoke(ctx, reg, inv, read)
+	if err != nil {
+		return nil, err
+	}
+	contents, ok := result.([]ResourceContent)
+	if !ok {
+		return nil, NewError(CodeInternalError, fmt.Errorf("middleware returned %T for resource %s", result, uri))
+	}
+	return contents, nil
+}
+
+// Use adds middleware that wraps reads of every resource and template in the
+// registry.
+func (r *ResourceRegistry) Use(mw ...Middleware) {
+	r.middleware.use(mw)
+}
+
+// UseTag adds middleware that wraps reads of every resource and template
+// tagged with tag.
+func (r *ResourceRegistry) UseTag(tag string, mw ...Middleware) {
+	r.middleware.useTag(tag, mw)
+}
+
+// ResourceNotFound returns a [CodeResourceNotFound] error for uri. Resource
+// readers can return it for URIs that match a template but don't exist.
+func ResourceNotFound(uri string) *Error {
+	return NewError(CodeResourceNotFound, fmt.Errorf("resource not found: %s", uri)).
+		WithData(map[string]string{"uri": uri})
+}
@@ -0,0 +1,97 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// TextResult returns a tool result with a single text content item.
+func TextResult(text string) *CallToolResponse {
+	return &CallToolResponse{Content: []Content{{Type: "text", Text: text}}}
+}
+
+// JSONResult returns a tool result with v encoded as JSON into a single text
+// content item and, if it encodes to a JSON object, also sent as structured
+// content.
+func JSONResult(v any) (*CallToolResponse, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	resp := TextResult(string(bs))
+	if len(bs) > 0 && bs[0] == '{' {
+		resp.StructuredContent = bs
+	}
+	return resp, nil
+}
+
+// ImageResult returns a tool result with a single image content item.
+func ImageResult(data []byte, mimeType string) *CallToolResponse {
+	return &CallToolResponse{Content: []Content{{
+		Type:     "image",
+		Data:     base64.StdEncoding.EncodeToString(data),
+		MimeType: mimeType,
+	}}}
+}
+
+// ErrorResult returns a tool result that reports err to the model: IsError
+// is set and the content is the error's message. Tools should report
+// failures of the tool itself this way, and reserve JSON-RPC errors for
+// protocol failures such as an unknown tool or invalid arguments.
+func ErrorResult(err error) *CallToolResponse {
+	resp := TextResult(err.Error())
+	resp.IsError = true
+	return resp
+}
+
+// ProtocolError marks err as a protocol failure, such as a request the tool
+// can't make sense of, so that it stays a JSON-RPC error under
+// [WithToolErrorResults]. Wrap an [*Error] to choose the error code. The
+// returned error wraps err, so [errors.Is] and [errors.As] still find it.
+// ProtocolError returns nil if err is nil.
+func ProtocolError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &protocolError{err}
+}
+
+type protocolError struct {
+	err error
+}
+
+func (e *protocolError) Error() string {
+	return e.err.Error()
+}
+
+func (e *protocolError) Unwrap() error {
+	return e.err
+}
+
+// isProtocolError reports whether err from a tools/call handler must stay a
+// JSON-RPC error rather than become an [ErrorResult]: an error marked with
+// [ProtocolError], [ErrUnimplemented], or the error of a cancelled or timed
+// out context.
+func isProtocolError(err error) bool {
+	var perr *protocolError
+	return errors.As(err, &perr) ||
+		errors.Is(err, ErrUnimplemented) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// toolErrorResults returns an interceptor that turns errors from tools/call
+// handlers into [ErrorResult] results.
+func toolErrorResults() Interceptor {
+	return UnaryInterceptorFunc(func(next UnaryFunc) UnaryFunc {
+		return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			resp, err := next(ctx, request)
+			if err == nil || request.Method() != string(MethodCallTool) || isProtocolError(err) {
+				return resp, err
+			}
+			return NewResponse(ErrorResult(err)), nil
+		}
+	})
+}
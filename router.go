@@ -1,11 +1,22 @@
 package mcp
 
-import "sync"
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrConnectionClosed is returned, wrapped in an [*Error] with
+// [CodeConnectionClosed], by calls that can't complete because the
+// connection has ended.
+var ErrConnectionClosed = errors.New("mcp: connection closed")
 
 type router struct {
-	lock  sync.Mutex
-	next  uint64
-	boxes map[uint64]chan *Message
+	lock   sync.Mutex
+	next   uint64
+	boxes  map[uint64]chan *Message
+	closed bool
+	err    error
 }
 
 func newRouter() *router {
@@ -14,14 +25,20 @@ func newRouter() *router {
 	}
 }
 
-func (r *router) Add() (uint64, chan *Message) {
+// Add reserves an id for an outgoing request and returns the inbox its
+// response is delivered to. The inbox is closed without a response if the
+// connection ends first. Add fails once the router is closed.
+func (r *router) Add() (uint64, chan *Message, error) {
 	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return 0, nil, r.closedError()
+	}
 	id := r.next
 	r.next++
 	inbox := make(chan *Message, 1)
 	r.boxes[id] = inbox
-	r.lock.Unlock()
-	return id, inbox
+	return id, inbox, nil
 }
 
 func (r *router) Remove(id uint64) (chan *Message, bool) {
@@ -33,3 +50,50 @@ func (r *router) Remove(id uint64) (chan *Message, bool) {
 	r.lock.Unlock()
 	return inbox, ok
 }
+
+// close records that the connection ended with err, which is nil for a
+// clean end, and fails every pending request.
+func (r *router) close(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.err = err
+	for id, inbox := range r.boxes {
+		delete(r.boxes, id)
+		close(inbox)
+	}
+}
+
+// Err returns nil while the connection is open and the reason it ended
+// afterwards: ErrConnectionClosed or the error that ended it.
+func (r *router) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.closed {
+		return nil
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return ErrConnectionClosed
+}
+
+// closedError returns the error for a request that failed because the
+// connection ended. r.lock must be held.
+func (r *router) closedError() error {
+	err := ErrConnectionClosed
+	if r.err != nil {
+		err = fmt.Errorf("%w: %w", ErrConnectionClosed, r.err)
+	}
+	return NewError(CodeConnectionClosed, err)
+}
+
+// failed returns the error for a request whose inbox was closed.
+func (r *router) failed() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.closedError()
+}
@@ -7,6 +7,23 @@ type Stream interface {
 	Send(msg *Message) error
 }
 
+// A SessionStream is a Stream that carries several sessions, such as one per
+// connected SSE client. Incoming messages name their session with the
+// "session_id" metadata key, and outgoing messages must carry the same key.
+// Messages for sessions that aren't open are rejected.
+type SessionStream interface {
+	Stream
+
+	// OpenedSessions returns a channel that receives the ID of each session
+	// whose connection has opened. The stream must not deliver a message
+	// for a session before its ID has been received from this channel.
+	OpenedSessions() <-chan string
+
+	// ClosedSessions returns a channel that receives the ID of each session
+	// whose connection has closed.
+	ClosedSessions() <-chan string
+}
+
 type Message struct {
 	ID      *json.Number     `json:"id,omitempty"`
 	JsonRPC *string          `json:"jsonrpc"`
@@ -3,37 +3,47 @@ package mcp
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 )
 
 func (s *Server) ServeMCP(ctx context.Context, msg *Message) (*Message, error) {
-	h := s.handler
 	switch m := Method(*msg.Method); m {
 	case MethodInitialize:
-		return serveMCP(ctx, s.base, msg, h.Initialize)
-	case MethodCompletion:
-		return serveMCP(ctx, s.base, msg, h.Completion)
+		return serveMCP(ctx, s.base, msg, s.initialize)
 	case MethodListTools:
-		return serveMCP(ctx, s.base, msg, h.ListTools)
+		if s.tools != nil {
+			return serveMCP(ctx, s.base, msg, s.tools.ListTools)
+		}
 	case MethodCallTool:
-		return serveMCP(ctx, s.base, msg, h.CallTool)
+		if s.tools != nil {
+			return serveMCP(ctx, s.base, msg, s.tools.CallTool)
+		}
 	case MethodListPrompts:
-		return serveMCP(ctx, s.base, msg, h.ListPrompts)
+		if s.prompts != nil {
+			return serveMCP(ctx, s.base, msg, s.prompts.ListPrompts)
+		}
 	case MethodGetPrompt:
-		return serveMCP(ctx, s.base, msg, h.GetPrompt)
+		if s.prompts != nil {
+			return serveMCP(ctx, s.base, msg, s.prompts.GetPrompt)
+		}
 	case MethodListResources:
-		return serveMCP(ctx, s.base, msg, h.ListResources)
+		if s.resources != nil {
+			return serveMCP(ctx, s.base, msg, s.resources.ListResources)
+		}
 	case MethodReadResource:
-		return serveMCP(ctx, s.base, msg, h.ReadResource)
+		if s.resources != nil {
+			return serveMCP(ctx, s.base, msg, s.resources.ReadResource)
+		}
 	case MethodListResourceTemplates:
-		return serveMCP(ctx, s.base, msg, h.ListResourceTemplates)
+		if s.resources != nil {
+			return serveMCP(ctx, s.base, msg, s.resources.ListResourceTemplates)
+		}
 	case MethodPing:
-		return serveMCP(ctx, s.base, msg, h.Ping)
-	case MethodSetLogLevel:
-		return serveMCP(ctx, s.base, msg, h.SetLogLevel)
-	default:
-		return nil, fmt.Errorf("unknown method: %s", m)
+		if !s.mux.Handles(m) {
+			return serveMCP(ctx, s.base, msg, s.mux.Ping)
+		}
 	}
+	return s.mux.serve(ctx, s.base, msg)
 }
 
 func serveMCP[T, V any](ctx context.Context, cfg *base, msg *Message, method func(ctx context.Context, req *Request[T]) (*Response[V], error)) (*Message, error) {
@@ -89,10 +99,7 @@ func serveMCP[T, V any](ctx context.Context, cfg *base, msg *Message, method fun
 			Metadata: msg.Metadata,
 			ID:       msg.ID,
 			JsonRPC:  msg.JsonRPC,
-			Error: &ErrorDetail{
-				Code:    9,
-				Message: err.Error(),
-			},
+			Error:    errorDetail(err),
 		}, nil
 	}
 
@@ -119,3 +126,20 @@ func serveMCP[T, V any](ctx context.Context, cfg *base, msg *Message, method fun
 		Result:   &rawmsg,
 	}, nil
 }
+
+func errorDetail(err error) *ErrorDetail {
+	detail := &ErrorDetail{
+		Code:    9,
+		Message: err.Error(),
+	}
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		detail.Code = rpcErr.code
+		if rpcErr.data != nil {
+			if data, err := json.Marshal(rpcErr.data); err == nil {
+				detail.Data = data
+			}
+		}
+	}
+	return detail
+}
@@ -2,7 +2,12 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 )
 
 type Method string
@@ -17,9 +22,13 @@ const (
 	MethodListResources         Method = "resources/list"
 	MethodReadResource          Method = "resources/read"
 	MethodListResourceTemplates Method = "resources/templates/list"
+	MethodSubscribe             Method = "resources/subscribe"
+	MethodUnsubscribe           Method = "resources/unsubscribe"
 	MethodPing                  Method = "ping"
 	MethodSetLogLevel           Method = "logging/setLevel"
 	MethodNotificationsMessage  Method = "notifications/message"
+	MethodResourceUpdated       Method = "notifications/resources/updated"
+	MethodCancelled             Method = "notifications/cancelled"
 )
 
 type ServerHandler interface {
@@ -38,40 +47,44 @@ type ServerHandler interface {
 
 type UnimplementedServer struct{}
 
+// unimplementedServer tells the server that a handler embeds
+// UnimplementedServer. See [WithCapabilities].
+func (s *UnimplementedServer) unimplementedServer() {}
+
 func (s *UnimplementedServer) Initialize(ctx context.Context, req *Request[InitializeRequest]) (*Response[InitializeResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) ListTools(ctx context.Context, req *Request[ListToolsRequest]) (*Response[ListToolsResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) CallTool(ctx context.Context, req *Request[CallToolRequest]) (*Response[CallToolResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) ListPrompts(ctx context.Context, req *Request[ListPromptsRequest]) (*Response[ListPromptsResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) GetPrompt(ctx context.Context, req *Request[GetPromptRequest]) (*Response[GetPromptResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) ListResources(ctx context.Context, req *Request[ListResourcesRequest]) (*Response[ListResourcesResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) ReadResource(ctx context.Context, req *Request[ReadResourceRequest]) (*Response[ReadResourceResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) ListResourceTemplates(ctx context.Context, req *Request[ListResourceTemplatesRequest]) (*Response[ListResourceTemplatesResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) Completion(ctx context.Context, req *Request[CompletionRequest]) (*Response[CompletionResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 func (s *UnimplementedServer) Ping(ctx context.Context, req *Request[PingRequest]) (*Response[PingResponse], error) {
@@ -79,58 +92,346 @@ func (s *UnimplementedServer) Ping(ctx context.Context, req *Request[PingRequest
 }
 
 func (s *UnimplementedServer) SetLogLevel(ctx context.Context, req *Request[SetLogLevelRequest]) (*Response[SetLogLevelResponse], error) {
-	return nil, fmt.Errorf("unimplemented")
+	return nil, ErrUnimplemented
 }
 
 type serverConfig struct {
-	interceptors []Interceptor
+	interceptors          []Interceptor
+	tools                 *ToolRegistry
+	prompts               *PromptRegistry
+	resources             *ResourceRegistry
+	validateToolArguments bool
+	validateToolOutput    bool
+	toolErrorResults      bool
+	experimental          map[string]json.RawMessage
+	capabilities          ServerCapabilities
+	onSessionStart        []func(ctx context.Context, s *Session)
+	onSessionEnd          []func(ctx context.Context, s *Session)
+	limiter               *limiter
+	ordering              ordering
+	callTimeouts          timeouts
+	handlerTimeouts       timeouts
+	onPanic               PanicHandler
+	listChangedDebounce   time.Duration
 }
 
 type Server struct {
-	handler ServerHandler
-	base    *base
+	mux       *Mux
+	base      *base
+	tools     *ToolRegistry
+	prompts   *PromptRegistry
+	resources *ResourceRegistry
+
+	experimental map[string]json.RawMessage
+	capabilities ServerCapabilities
+
+	sessions       sessions
+	listChanged    *listNotifier
+	onSessionStart []func(ctx context.Context, s *Session)
+	onSessionEnd   []func(ctx context.Context, s *Session)
+	ending         sync.WaitGroup // sessions whose OnSessionEnd hooks are running
 }
 
-func NewServer(stream Stream, handler ServerHandler, opts ...Option) *Server {
-	cfg := &serverConfig{}
+func NewServer(stream Stream, handler ServerHandler, opts ...ServerOption) *Server {
+	cfg := &serverConfig{listChangedDebounce: DefaultListChangedDebounce}
 	for _, opt := range opts {
 		opt.applyToServer(cfg)
 	}
-	return &Server{
-		handler: handler,
-		base: &base{
-			router:       newRouter(),
-			interceptors: cfg.interceptors,
-			stream:       stream,
-		},
+	interceptors := cfg.interceptors
+	if cfg.validateToolArguments && cfg.tools != nil {
+		interceptors = append(slices.Clip(interceptors), toolArgumentValidator(cfg.tools))
+	}
+	if cfg.validateToolOutput && cfg.tools != nil {
+		interceptors = append(slices.Clip(interceptors), toolOutputValidator(cfg.tools))
+	}
+	if cfg.toolErrorResults {
+		interceptors = append(slices.Clip(interceptors), toolErrorResults())
+	}
+	mux, ok := handler.(*Mux)
+	if !ok {
+		mux = handlerMux(handler)
+	}
+	b := &base{
+		router:       newRouter(),
+		interceptors: interceptors,
+		stream:       stream,
+		limiter:      cfg.limiter,
+		sequencer:    newSequencer(cfg.ordering),
+
+		callTimeouts:    cfg.callTimeouts,
+		handlerTimeouts: cfg.handlerTimeouts,
+		onPanic:         cfg.onPanic,
+	}
+	s := &Server{
+		base:      b,
+		sessions:  sessions{base: b},
+		mux:       mux,
+		tools:     cfg.tools,
+		prompts:   cfg.prompts,
+		resources: cfg.resources,
+
+		experimental: cfg.experimental,
+		capabilities: cfg.capabilities,
+		listChanged:  &listNotifier{delay: cfg.listChangedDebounce},
+
+		onSessionStart: cfg.onSessionStart,
+		onSessionEnd:   cfg.onSessionEnd,
+	}
+	b.routerFor = s.routerFor
+	b.bind = s.bind
+	if ss, ok := stream.(SessionStream); ok {
+		b.sessions = &sessionEvents{stream: ss, open: s.openSession, close: s.closeSession}
+	} else {
+		s.sessions.get("")
+	}
+	return s
+}
+
+// openSession starts tracking a session the stream opened.
+func (s *Server) openSession(ctx context.Context, id string) {
+	s.sessions.get(id)
+}
+
+// closeSession ends a session whose connection closed. Its OnSessionEnd
+// hooks run on their own goroutine so that they can't hold up the messages
+// of other sessions.
+func (s *Server) closeSession(ctx context.Context, id string) {
+	sess, ok := s.sessions.remove(id)
+	if !ok {
+		return
+	}
+	sess.base.router.close(nil)
+	s.ending.Add(1)
+	go func() {
+		defer s.ending.Done()
+		s.endSession(ctx, sess)
+	}()
+}
+
+// bind attaches the session an incoming message belongs to, if it is open.
+func (s *Server) bind(ctx context.Context, msg *Message) context.Context {
+	sess, ok := s.sessions.lookup(msg.Metadata["session_id"])
+	if !ok {
+		return ctx
+	}
+	return withSession(ctx, sess)
+}
+
+// routerFor returns the router of the session a response belongs to.
+func (s *Server) routerFor(msg *Message) *router {
+	sess, ok := s.sessions.lookup(msg.Metadata["session_id"])
+	if !ok {
+		return nil
+	}
+	return sess.base.router
+}
+
+// peers returns the session of the request being handled in ctx, or every
+// session outside of a handler. A server with no sessions has no peers, so
+// notifications it broadcasts go nowhere.
+func (s *Server) peers(ctx context.Context) ([]*base, error) {
+	if sess := SessionFromContext(ctx); sess != nil && s.sessions.contains(sess) {
+		return []*base{sess.base}, nil
+	}
+	sessions := s.sessions.list()
+	bs := make([]*base, len(sessions))
+	for i, sess := range sessions {
+		bs[i] = sess.base
+	}
+	return bs, nil
+}
+
+// QueueStats reports how many incoming messages are being handled and how
+// many are waiting for a slot. See [WithMaxConcurrentRequests].
+func (s *Server) QueueStats() QueueStats {
+	return s.base.limiter.stats()
+}
+
+// Sessions returns the server's current sessions. Transports that carry a
+// single client always have exactly one.
+func (s *Server) Sessions() []*Session {
+	return s.sessions.list()
+}
+
+// register adds a handler to the server's [Mux]. If the server was created
+// with a Mux as its handler, that is the Mux the handler is added to. It
+// panics if a registry serves method, since the handler would never be
+// called.
+func (s *Server) register(method Method, e *muxEntry) {
+	if s.servedByRegistry(method) {
+		panic(fmt.Sprintf("mcp: %s is served by the server's registry", method))
+	}
+	s.mux.register(method, e)
+}
+
+// servedByRegistry reports whether one of the server's registries serves
+// method in place of its handler.
+func (s *Server) servedByRegistry(method Method) bool {
+	switch method {
+	case MethodListTools, MethodCallTool:
+		return s.tools != nil
+	case MethodListPrompts, MethodGetPrompt:
+		return s.prompts != nil
+	case MethodListResources, MethodReadResource, MethodListResourceTemplates:
+		return s.resources != nil
 	}
+	return false
 }
 
+// Listen reads and serves messages until ctx ends or the stream fails. It
+// returns nil when the stream ends with io.EOF, for example when the host
+// closes stdin, or after [Server.Shutdown]. Once it returns, every session
+// has ended. A server listens only once; create a new one to serve again.
 func (s *Server) Listen(ctx context.Context) error {
-	return s.base.listen(ctx, s.processMessage)
+	defer s.watchRegistries()()
+	if s.base.sessions == nil {
+		s.sessions.get("")
+	}
+	err := s.base.listen(ctx, s.processMessage)
+	for _, sess := range s.sessions.removeAll() {
+		sess.base.router.close(err)
+		s.endSession(ctx, sess)
+	}
+	s.ending.Wait()
+	return err
+}
+
+// watchRegistries queues list_changed notifications for the sessions
+// affected by changes to the server's registries, until the returned
+// function is called.
+func (s *Server) watchRegistries() func() {
+	watch := func(w *watchers, kind listKind) func() {
+		return w.watch(func(affected func(*Session) bool) {
+			s.listChanged.changed(kind, s.sessions.list(), affected)
+		})
+	}
+	var unwatch []func()
+	if s.tools != nil {
+		unwatch = append(unwatch, watch(&s.tools.list.watchers, toolList))
+	}
+	if s.prompts != nil {
+		unwatch = append(unwatch, watch(&s.prompts.list.watchers, promptList))
+	}
+	if s.resources != nil {
+		unwatch = append(unwatch, watch(&s.resources.list.watchers, resourceList))
+	}
+	return func() {
+		for _, fn := range unwatch {
+			fn()
+		}
+		s.listChanged.stop()
+	}
+}
+
+// Err returns nil while the server is listening or before it starts, and
+// the reason it stopped afterwards: the error [Server.Listen] returned, or
+// [ErrConnectionClosed] if it stopped cleanly. Calls to the client fail once
+// the server has stopped.
+func (s *Server) Err() error {
+	return s.base.router.Err()
+}
+
+func (s *Server) endSession(ctx context.Context, sess *Session) {
+	s.listChanged.forget(sess)
+	if s.tools != nil {
+		s.tools.list.forget(&s.tools.mu, sess)
+	}
+	if s.prompts != nil {
+		s.prompts.list.forget(&s.prompts.mu, sess)
+	}
+	if s.resources != nil {
+		s.resources.list.forget(&s.resources.mu, sess)
+	}
+	if !sess.hasStarted() {
+		return
+	}
+	for _, fn := range s.onSessionEnd {
+		fn(ctx, sess)
+	}
+}
+
+// ClientCapabilities returns the capabilities the client sent in its
+// initialize request, or nil if the client has not initialized yet. A server
+// with several sessions has no single client and returns nil; handlers use
+// the [Session.ClientCapabilities] of their own session instead.
+func (s *Server) ClientCapabilities() *ClientCapabilities {
+	sessions := s.sessions.list()
+	if len(sessions) != 1 {
+		return nil
+	}
+	return sessions[0].ClientCapabilities()
+}
+
+// initialize wraps the handler's Initialize method. Handlers that don't
+// implement it get a default response, and any capability the handler leaves
+// unset is filled in from what the handler actually implements.
+func (s *Server) initialize(ctx context.Context, req *Request[InitializeRequest]) (*Response[InitializeResponse], error) {
+	resp, err := s.mux.Initialize(ctx, req)
+	if errors.Is(err, ErrUnimplemented) {
+		resp, err = NewResponse(&InitializeResponse{
+			ProtocolVersion: req.Params.ProtocolVersion,
+		}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Result.Capabilities.merge(s.deriveCapabilities())
+
+	if sess := SessionFromContext(ctx); sess != nil {
+		params := *req.Params
+		if sess.initialized(&params) {
+			for _, fn := range s.onSessionStart {
+				fn(ctx, sess)
+			}
+		}
+	}
+
+	return resp, nil
 }
 
+// Ping pings the client. See [Call] for which session it goes to.
 func (s *Server) Ping(ctx context.Context, request *Request[PingRequest]) (*Response[PingResponse], error) {
-	return call[PingRequest, PingResponse](ctx, s.base, "ping", request)
+	return Call[PingRequest, PingResponse](ctx, s, MethodPing, request)
 }
 
+// LogMessage sends a log message to the session of the request being handled
+// in ctx, or to every session outside of a handler. The list_changed and
+// updated notifications below are sent the same way.
 func (s *Server) LogMessage(ctx context.Context, request *Request[LogMessageRequest]) error {
-	return notify[LogMessageRequest](ctx, s.base, "notifications/message", request)
+	return Notify(ctx, s, MethodNotificationsMessage, request)
 }
 
 func (s *Server) ToolsListChanged(ctx context.Context) error {
-	return notify[emptyRequest](ctx, s.base, "notifications/tools/list_changed", NewRequest(&emptyRequest{}))
+	return Notify(ctx, s, "notifications/tools/list_changed", NewRequest(&emptyRequest{}))
 }
 
 func (s *Server) PromptsListChanged(ctx context.Context) error {
-	return notify[emptyRequest](ctx, s.base, "notifications/prompts/list_changed", NewRequest(&emptyRequest{}))
+	return Notify(ctx, s, "notifications/prompts/list_changed", NewRequest(&emptyRequest{}))
 }
 
 func (s *Server) ResourcesListChanged(ctx context.Context) error {
-	return notify[emptyRequest](ctx, s.base, "notifications/resources/list_changed", NewRequest(&emptyRequest{}))
+	return Notify(ctx, s, "notifications/resources/list_changed", NewRequest(&emptyRequest{}))
+}
+
+// ResourceUpdated tells the client that the resource at uri has changed.
+// Servers should only send it for resources the client has subscribed to.
+func (s *Server) ResourceUpdated(ctx context.Context, uri string) error {
+	return Notify(ctx, s, MethodResourceUpdated, NewRequest(&ResourceUpdatedNotification{URI: uri}))
 }
 
 func (s *Server) processMessage(ctx context.Context, msg *Message) error {
+	if SessionFromContext(ctx) == nil {
+		if msg.ID == nil {
+			return nil
+		}
+		return s.base.stream.Send(&Message{
+			Metadata: msg.Metadata,
+			ID:       msg.ID,
+			JsonRPC:  msg.JsonRPC,
+			Error:    errorDetail(NewError(CodeInvalidRequest, fmt.Errorf("unknown session %q", msg.Metadata["session_id"]))),
+		})
+	}
 	rr, err := s.ServeMCP(ctx, msg)
 	if err != nil {
 		return err
@@ -138,5 +439,5 @@ func (s *Server) processMessage(ctx context.Context, msg *Message) error {
 	if rr == nil {
 		return nil
 	}
-	return s.base.stream.Send(rr)
+	return s.base.reply(ctx, *msg.Method, rr)
 }
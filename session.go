@@ -0,0 +1,283 @@
+package mcp
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// A Session holds the state of one client connected to a server. Handlers
+// get the session of the request they are serving from [SessionFromContext].
+//
+// Each session is its own logical connection with its own request ids. Its
+// methods, and [Call] and [Notify] with the session as the peer, send
+// messages to that client only.
+type Session struct {
+	id          string
+	transportID string
+	base        *base
+
+	mu      sync.Mutex
+	init    *InitializeRequest
+	values  map[any]any
+	started bool
+	ended   bool
+}
+
+func newSession(transportID string, b *base) *Session {
+	id := transportID
+	if id == "" {
+		id = uuid.New().String()
+	}
+	return &Session{
+		id:          id,
+		transportID: transportID,
+		values:      map[any]any{},
+		base: &base{
+			router:       newRouter(),
+			stream:       &sessionStream{Stream: b.stream, id: transportID},
+			interceptors: b.interceptors,
+			callTimeouts: b.callTimeouts,
+		},
+	}
+}
+
+func (s *Session) peers(ctx context.Context) ([]*base, error) {
+	return []*base{s.base}, nil
+}
+
+func (s *Session) Ping(ctx context.Context, request *Request[PingRequest]) (*Response[PingResponse], error) {
+	return call[PingRequest, PingResponse](ctx, s.base, string(MethodPing), request)
+}
+
+func (s *Session) LogMessage(ctx context.Context, request *Request[LogMessageRequest]) error {
+	return notify[LogMessageRequest](ctx, s.base, string(MethodNotificationsMessage), request)
+}
+
+func (s *Session) ToolsListChanged(ctx context.Context) error {
+	return notify[emptyRequest](ctx, s.base, "notifications/tools/list_changed", NewRequest(&emptyRequest{}))
+}
+
+func (s *Session) PromptsListChanged(ctx context.Context) error {
+	return notify[emptyRequest](ctx, s.base, "notifications/prompts/list_changed", NewRequest(&emptyRequest{}))
+}
+
+func (s *Session) ResourcesListChanged(ctx context.Context) error {
+	return notify[emptyRequest](ctx, s.base, "notifications/resources/list_changed", NewRequest(&emptyRequest{}))
+}
+
+// ResourceUpdated tells the client that the resource at uri has changed.
+func (s *Session) ResourceUpdated(ctx context.Context, uri string) error {
+	return notify[ResourceUpdatedNotification](ctx, s.base, string(MethodResourceUpdated), NewRequest(&ResourceUpdatedNotification{URI: uri}))
+}
+
+// sessionStream tags outgoing messages with the session's transport ID.
+type sessionStream struct {
+	Stream
+	id string
+}
+
+func (s *sessionStream) Send(msg *Message) error {
+	if s.id != "" {
+		metadata := maps.Clone(msg.Metadata)
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata["session_id"] = s.id
+		msg.Metadata = metadata
+	}
+	return s.Stream.Send(msg)
+}
+
+// ID returns the session's ID. Transports that multiplex clients, like sse,
+// provide their own IDs; otherwise a random one is generated.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// InitializeRequest returns the parameters the client sent to initialize the
+// session, or nil if it hasn't initialized yet.
+func (s *Session) InitializeRequest() *InitializeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.init
+}
+
+// ClientCapabilities returns the capabilities the client sent in its
+// initialize request, or nil if it hasn't initialized yet.
+func (s *Session) ClientCapabilities() *ClientCapabilities {
+	init := s.InitializeRequest()
+	if init == nil {
+		return nil
+	}
+	caps := init.Capabilities
+	return &caps
+}
+
+// initialized records the client's initialize request and reports whether
+// this is the first time, in which case the session has just started.
+func (s *Session) initialized(req *InitializeRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init = req
+	if s.started {
+		return false
+	}
+	s.started = true
+	return true
+}
+
+type sessionContextKey struct{}
+
+// SessionFromContext returns the session of the request being handled, or nil
+// if ctx doesn't belong to a server request.
+func SessionFromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return s
+}
+
+func withSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, s)
+}
+
+// A Key identifies a typed value stored in a [Session]. Keys are compared by
+// identity, so each call to [NewKey] returns a distinct key.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a new key. The name is only used for debugging.
+func NewKey[T any](name string) *Key[T] {
+	return &Key[T]{name: name}
+}
+
+func (k *Key[T]) String() string {
+	return k.name
+}
+
+// Get returns the value stored under k in the session.
+func (k *Key[T]) Get(s *Session) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[k].(T)
+	return v, ok
+}
+
+// Set stores v under k in the session.
+func (k *Key[T]) Set(s *Session, v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[k] = v
+}
+
+// Delete removes the value stored under k from the session.
+func (k *Key[T]) Delete(s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, k)
+}
+
+// sessionEvents hands the sessions a SessionStream opens and closes to a
+// server.
+type sessionEvents struct {
+	stream      SessionStream
+	open, close func(ctx context.Context, id string)
+}
+
+// sessions tracks the sessions of a server by transport ID.
+type sessions struct {
+	base *base
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// get returns the session with the given transport ID, creating it if
+// necessary. The empty ID is used by transports that carry a single client.
+func (ss *sessions) get(id string) *Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.sessions == nil {
+		ss.sessions = map[string]*Session{}
+	}
+	s, ok := ss.sessions[id]
+	if !ok {
+		s = newSession(id, ss.base)
+		ss.sessions[id] = s
+	}
+	return s
+}
+
+func (ss *sessions) lookup(id string) (*Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.sessions[id]
+	return s, ok
+}
+
+// contains reports whether s is one of the tracked sessions.
+func (ss *sessions) contains(s *Session) bool {
+	found, ok := ss.lookup(s.transportID)
+	return ok && found == s
+}
+
+func (ss *sessions) list() []*Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	list := make([]*Session, 0, len(ss.sessions))
+	for _, s := range ss.sessions {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *Session) int {
+		return strings.Compare(a.id, b.id)
+	})
+	return list
+}
+
+// remove forgets the session with the given transport ID.
+func (ss *sessions) remove(id string) (*Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	s, ok := ss.sessions[id]
+	if ok {
+		s.end()
+	}
+	delete(ss.sessions, id)
+	return s, ok
+}
+
+// removeAll forgets every session.
+func (ss *sessions) removeAll() []*Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	all := slices.Collect(maps.Values(ss.sessions))
+	for _, s := range all {
+		s.end()
+	}
+	ss.sessions = nil
+	return all
+}
+
+func (s *Session) hasStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// end marks the session as removed from the server, before its settings in
+// the registries are forgotten.
+func (s *Session) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ended = true
+}
+
+func (s *Session) hasEnded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ended
+}
@@ -0,0 +1,161 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// lifecycle tracks the handlers running on a connection so that it can be
+// shut down once they finish.
+type lifecycle struct {
+	mu      sync.Mutex
+	active  int
+	closing chan struct{} // closed when shutdown starts
+	idle    chan struct{} // closed when no handlers run after shutdown started
+	done    chan struct{} // closed when shutdown has finished
+}
+
+// closingChan returns a channel that is closed once shutdown starts.
+func (l *lifecycle) closingChan() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closing == nil {
+		l.closing = make(chan struct{})
+	}
+	return l.closing
+}
+
+// doneChan returns a channel that is closed once shutdown has finished.
+func (l *lifecycle) doneChan() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	return l.done
+}
+
+// finish records that shutdown has finished.
+func (l *lifecycle) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done == nil {
+		l.done = make(chan struct{})
+	}
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+}
+
+// begin records that a handler is starting. It reports false if the
+// connection is shutting down, in which case the handler must not run.
+func (l *lifecycle) begin() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.idle != nil {
+		return false
+	}
+	l.active++
+	return true
+}
+
+// end records that a handler has finished.
+func (l *lifecycle) end() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	if l.active == 0 && l.idle != nil {
+		select {
+		case <-l.idle:
+		default:
+			close(l.idle)
+		}
+	}
+}
+
+// close starts shutdown and returns a channel that is closed once every
+// running handler has finished.
+func (l *lifecycle) close() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.idle != nil {
+		return l.idle
+	}
+	if l.closing == nil {
+		l.closing = make(chan struct{})
+	}
+	close(l.closing)
+	l.idle = make(chan struct{})
+	if l.active == 0 {
+		close(l.idle)
+	}
+	return l.idle
+}
+
+// shutdown stops handling new requests, waits for running handlers to finish
+// and closes the stream. If ctx ends first, running handlers are cancelled
+// and the stream is closed anyway. listen returns once shutdown finishes,
+// even if the stream can't be closed.
+func (b *base) shutdown(ctx context.Context) error {
+	defer b.lifecycle.finish()
+	var err error
+	idle := b.lifecycle.close()
+	select {
+	case <-idle:
+	default:
+		// Checked on its own first, since select picks at random when
+		// ctx has ended too, as it always has for Close.
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			b.handlers.cancelAll()
+			err = ctx.Err()
+		}
+	}
+	if c, ok := b.stream.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Shutdown gracefully shuts down the server. It stops accepting new
+// requests, which are answered with [CodeConnectionClosed], waits for running
+// handlers to finish and then closes the stream if it implements
+// [io.Closer], which flushes messages the transport has queued. Responses to
+// the server's own requests are still delivered while it waits.
+//
+// If ctx ends before the handlers finish, their contexts are cancelled, the
+// stream is closed and Shutdown returns ctx.Err(). [Server.Listen] returns
+// nil once Shutdown has returned, whether or not the stream could be
+// closed. A stream without a Close method is left for its owner to close.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.base.shutdown(ctx)
+}
+
+// Close closes the server immediately, cancelling running handlers. See
+// [Server.Shutdown].
+func (s *Server) Close() error {
+	return s.base.shutdown(cancelled())
+}
+
+// Shutdown gracefully shuts down the client. See [Server.Shutdown].
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.base.shutdown(ctx)
+}
+
+// Close closes the client immediately, cancelling running handlers. See
+// [Client.Shutdown].
+func (c *Client) Close() error {
+	return c.base.shutdown(cancelled())
+}
+
+func cancelled() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
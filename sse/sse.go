@@ -5,25 +5,62 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"sync"
 
 	"github.com/google/uuid"
 	"github.com/riza-io/mcp-go"
 )
 
+// session is the outgoing queue of one SSE connection. Messages are written
+// in the order they were sent.
 type session struct {
-	out chan *mcp.Message
+	mu    sync.Mutex
+	queue []*mcp.Message
+	wake  chan struct{}
+
+	posts sync.WaitGroup // POST requests delivering a message
+}
+
+func (s *session) push(msg *mcp.Message) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) drain() []*mcp.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msgs := s.queue
+	s.queue = nil
+	return msgs
 }
 
-type message struct {
-	sessionID string
-	msg       *mcp.Message
+// incoming is a message posted by a client, or the end of a session. Both
+// travel through the same channel so that a session ends after its messages.
+type incoming struct {
+	msg    *mcp.Message
+	closed string
 }
 
+// Stream is an [mcp.SessionStream] that serves each client connected to the
+// SSE route as its own session. Messages are received in the order their POST
+// requests were made, and each POST completes once its message has been
+// received.
 type Stream struct {
 	mu       sync.RWMutex
-	in       chan *mcp.Message
+	in       chan incoming
+	opened   chan string
+	closed   chan string
 	sessions map[string]*session
+
+	done     chan struct{} // closed by Close
+	shutdown bool
+	conns    sync.WaitGroup
 }
 
 func writeEvent(w http.ResponseWriter, id string, event string, data string) {
@@ -34,15 +71,30 @@ func writeEvent(w http.ResponseWriter, id string, event string, data string) {
 
 func NewStream(mux *http.ServeMux, sseRoute, messagesRoute string) *Stream {
 	s := &Stream{
-		in:       make(chan *mcp.Message),
+		in:       make(chan incoming),
+		opened:   make(chan string),
+		closed:   make(chan string),
 		sessions: make(map[string]*session),
+		done:     make(chan struct{}),
 	}
 
 	mux.HandleFunc("POST "+messagesRoute, func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Query().Get("session_id") == "" {
+		id := r.URL.Query().Get("session_id")
+		if id == "" {
 			http.Error(w, "session_id is required", http.StatusBadRequest)
 			return
 		}
+		s.mu.RLock()
+		sess, ok := s.sessions[id]
+		if ok {
+			sess.posts.Add(1)
+		}
+		s.mu.RUnlock()
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		defer sess.posts.Done()
 		defer r.Body.Close()
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
@@ -72,9 +124,16 @@ func NewStream(mux *http.ServeMux, sseRoute, messagesRoute string) *Stream {
 
 		msg.Metadata = metadata
 
-		go func() {
-			s.in <- &msg
-		}()
+		// The message is handed to the server before the request completes,
+		// so a server that has stopped reading stalls the client's POST.
+		select {
+		case s.in <- incoming{msg: &msg}:
+		case <-s.done:
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			return
+		}
 
 		w.WriteHeader(http.StatusNoContent)
 	})
@@ -94,14 +153,46 @@ func NewStream(mux *http.ServeMux, sseRoute, messagesRoute string) *Stream {
 		}
 
 		id := uuid.New().String()
-		out := make(chan *mcp.Message)
+		sess := &session{
+			wake: make(chan struct{}, 1),
+		}
 
 		s.mu.Lock()
-		s.sessions[id] = &session{
-			out: out,
+		if s.shutdown {
+			s.mu.Unlock()
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		s.conns.Add(1)
+		s.mu.Unlock()
+		defer s.conns.Done()
+
+		// The server learns about the session before the client learns
+		// where to post its messages.
+		select {
+		case s.opened <- id:
+		case <-s.done:
+			return
+		case <-r.Context().Done():
+			return
 		}
+		s.mu.Lock()
+		s.sessions[id] = sess
 		s.mu.Unlock()
 
+		defer func() {
+			s.mu.Lock()
+			delete(s.sessions, id)
+			s.mu.Unlock()
+			// Messages already being posted are received before the
+			// session ends.
+			sess.posts.Wait()
+			select {
+			case s.in <- incoming{closed: id}:
+			case <-s.done:
+			}
+		}()
+
 		vals := r.URL.Query()
 		vals.Add("session_id", id)
 
@@ -110,24 +201,88 @@ func NewStream(mux *http.ServeMux, sseRoute, messagesRoute string) *Stream {
 		writeEvent(w, "1", "endpoint", session)
 		flusher.Flush()
 
-		for msg := range out {
-			bs, err := json.Marshal(msg)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+		event := 1
+		for {
+			closing := false
+			select {
+			case <-r.Context().Done():
 				return
+			case <-s.done:
+				closing = true
+			case <-sess.wake:
+			}
+			for _, msg := range sess.drain() {
+				bs, err := json.Marshal(msg)
+				if err != nil {
+					continue
+				}
+				event++
+				writeEvent(w, strconv.Itoa(event), "message", string(bs))
 			}
-			writeEvent(w, msg.ID.String(), "message", string(bs))
 			flusher.Flush()
+			if closing {
+				return
+			}
 		}
 	})
 
 	return s
 }
 
+// Recv returns the next message posted by a client. It returns io.EOF once
+// the stream is closed.
 func (s *Stream) Recv() (*mcp.Message, error) {
-	return <-s.in, nil
+	for {
+		select {
+		case in := <-s.in:
+			if in.msg != nil {
+				return in.msg, nil
+			}
+			// Recv isn't called again until the caller is done with the
+			// previous message, so every message of the session has been
+			// taken by now.
+			select {
+			case s.closed <- in.closed:
+			case <-s.done:
+				return nil, io.EOF
+			}
+		case <-s.done:
+			return nil, io.EOF
+		}
+	}
+}
+
+// Close stops accepting connections and messages, writes the messages queued
+// for each connected client and ends their SSE connections. It waits for the
+// queued messages to be written.
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return nil
+	}
+	s.shutdown = true
+	close(s.done)
+	s.mu.Unlock()
+	s.conns.Wait()
+	return nil
+}
+
+// OpenedSessions returns a channel that receives the ID of each session whose
+// SSE connection has opened.
+func (s *Stream) OpenedSessions() <-chan string {
+	return s.opened
+}
+
+// ClosedSessions returns a channel that receives the ID of each session whose
+// SSE connection has closed. A session's ID is sent from [Stream.Recv], after
+// every message posted for the session has been received, so the channel
+// must be read while Recv is being called.
+func (s *Stream) ClosedSessions() <-chan string {
+	return s.closed
 }
 
+// Send queues msg for the session named by its "session_id" metadata.
 func (s *Stream) Send(msg *mcp.Message) error {
 	if msg.Metadata == nil {
 		return fmt.Errorf("metadata is nil")
@@ -142,8 +297,6 @@ func (s *Stream) Send(msg *mcp.Message) error {
 	if !ok {
 		return fmt.Errorf("session not found")
 	}
-	go func() {
-		session.out <- msg
-	}()
+	session.push(msg)
 	return nil
 }
@@ -0,0 +1,127 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+type sequenceNotification struct {
+	N int `json:"n"`
+}
+
+func TestOrderedDelivery(t *testing.T) {
+	const n = 20
+
+	var mu sync.Mutex
+	var got []string
+	record := func(s string) {
+		mu.Lock()
+		got = append(got, s)
+		mu.Unlock()
+	}
+
+	mux := mcp.NewMux()
+	mcp.HandleNotification(mux, "x-test/sequence", func(ctx context.Context, req *mcp.Request[sequenceNotification]) error {
+		// Later messages finish first unless they are handled in order.
+		time.Sleep(time.Duration(n-req.Params.N) * 100 * time.Microsecond)
+		record(fmt.Sprint(req.Params.N))
+		return nil
+	})
+	ended := make(chan struct{})
+
+	httpMux := http.NewServeMux()
+	stream := NewStream(httpMux, "/sse", "/message")
+	srv := mcp.NewServer(stream, mux,
+		mcp.WithSequentialProcessing(),
+		mcp.OnSessionEnd(func(ctx context.Context, s *mcp.Session) {
+			close(ended)
+		}),
+	)
+	ts := httptest.NewServer(httpMux)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listened := make(chan error, 1)
+	go func() { listened <- srv.Listen(ctx) }()
+	defer func() {
+		srv.Close()
+		<-listened
+	}()
+
+	connCtx, disconnect := context.WithCancel(ctx)
+	defer disconnect()
+	req, err := http.NewRequestWithContext(connCtx, http.MethodGet, ts.URL+"/sse", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer resp.Body.Close()
+	endpoint := ""
+	scanner := bufio.NewScanner(resp.Body)
+	for endpoint == "" && scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			endpoint = data
+		}
+	}
+	if endpoint == "" {
+		t.Fatalf("no endpoint event: %v", scanner.Err())
+	}
+
+	post := func(body string) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+endpoint, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to post %s: %v", body, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: unexpected status %s", body, resp.Status)
+		}
+	}
+	post(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"1.0.0"}}`)
+	for i := range n {
+		post(fmt.Sprintf(`{"jsonrpc":"2.0","method":"x-test/sequence","params":{"n":%d}}`, i))
+	}
+	// The session ends while its notifications are still being handled,
+	// and none of them may be dropped.
+	disconnect()
+
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session never ended")
+	}
+	want := make([]string, 0, n)
+	for i := range n {
+		want = append(want, fmt.Sprint(i))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := len(got) == n
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("handled %v, want %v", got, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
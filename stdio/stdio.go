@@ -2,7 +2,9 @@ package stdio
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -10,25 +12,86 @@ import (
 	"github.com/riza-io/mcp-go"
 )
 
+// Stream carries messages as newline-delimited JSON over a reader and a
+// writer, such as os.Stdin and os.Stdout.
 type Stream struct {
-	rlock sync.Mutex
-	scan  *bufio.Scanner
+	r     io.Reader
 	w     io.Writer
 	wlock sync.Mutex
+
+	closeUnderlying bool
+
+	lines     chan []byte // closed once reading ends, with err set
+	err       error
+	startRecv sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type Option interface {
+	apply(s *Stream)
+}
+
+type optionFunc func(s *Stream)
+
+func (f optionFunc) apply(s *Stream) {
+	f(s)
 }
 
-func NewStream(r io.Reader, w io.Writer) *Stream {
-	return &Stream{
-		scan: bufio.NewScanner(r),
-		w:    w,
+// WithCloseUnderlying makes [Stream.Close] close the reader and the writer
+// too, if they implement io.Closer. Use it for pipes and connections the
+// stream owns, but not for os.Stdin and os.Stdout, which the rest of the
+// process may still use.
+func WithCloseUnderlying() Option {
+	return optionFunc(func(s *Stream) {
+		s.closeUnderlying = true
+	})
+}
+
+func NewStream(r io.Reader, w io.Writer, opts ...Option) *Stream {
+	s := &Stream{
+		r:     r,
+		w:     w,
+		lines: make(chan []byte),
+		done:  make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt.apply(s)
 	}
+	return s
 }
 
+// read scans lines from the reader until it fails or the stream is closed.
+func (s *Stream) read() {
+	scan := bufio.NewScanner(s.r)
+	for scan.Scan() {
+		select {
+		case s.lines <- bytes.Clone(scan.Bytes()):
+		case <-s.done:
+			return
+		}
+	}
+	s.err = scan.Err()
+	if s.err == nil {
+		s.err = io.EOF
+	}
+	close(s.lines)
+}
+
+// Recv reads the next message. It returns io.EOF once the reader is
+// exhausted or the stream is closed.
 func (s *Stream) Recv() (*mcp.Message, error) {
-	if !s.scan.Scan() {
-		return nil, s.scan.Err()
+	s.startRecv.Do(func() { go s.read() })
+	var line []byte
+	select {
+	case l, ok := <-s.lines:
+		if !ok {
+			return nil, s.err
+		}
+		line = l
+	case <-s.done:
+		return nil, io.EOF
 	}
-	line := s.scan.Bytes()
 	var msg mcp.Message
 	if err := json.Unmarshal(line, &msg); err != nil {
 		return nil, err
@@ -46,3 +109,27 @@ func (s *Stream) Send(msg *mcp.Message) error {
 	s.wlock.Unlock()
 	return err
 }
+
+// Close makes Recv return io.EOF. With [WithCloseUnderlying], it also closes
+// the reader and the writer passed to NewStream if they implement
+// io.Closer; otherwise they are left open, and a Recv blocked on the reader
+// returns without waiting for it. Messages are written as they are sent, so
+// there is nothing to flush.
+func (s *Stream) Close() error {
+	first := false
+	s.closeOnce.Do(func() {
+		close(s.done)
+		first = true
+	})
+	if !first || !s.closeUnderlying {
+		return nil
+	}
+	var errs []error
+	if c, ok := s.r.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	if c, ok := s.w.(io.Closer); ok {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a [Store] for an unknown or expired task.
+var ErrNotFound = errors.New("tasks: task not found")
+
+// A Store keeps the state of tasks. Implementations must be safe for
+// concurrent use. The [Manager] serializes updates to a task, so a Store
+// doesn't need to guard against lost updates.
+type Store interface {
+	// Put creates or replaces a task.
+	Put(ctx context.Context, t *Task) error
+	// Get returns the task with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Task, error)
+	// Delete removes a task. Deleting an unknown task is not an error.
+	Delete(ctx context.Context, id string) error
+	// DeleteExpired removes every task that expired at or before now.
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// MemoryStore is a [Store] that keeps tasks in memory.
+type MemoryStore struct {
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tasks: map[string]*Task{}}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, t *Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[t.ID] = t.clone()
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t.clone(), nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, id)
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, t := range s.tasks {
+		if t.expired(now) {
+			delete(s.tasks, id)
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of t that shares no slices with it.
+func (t *Task) clone() *Task {
+	c := *t
+	c.Output = slices.Clone(t.Output)
+	if t.Result != nil {
+		result := *t.Result
+		result.Content = slices.Clone(t.Result.Content)
+		c.Result = &result
+	}
+	return &c
+}
+
+func (t *Task) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
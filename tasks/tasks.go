@@ -0,0 +1,393 @@
+// Package tasks runs long-running tools in the background.
+//
+// A tool added with [AddTool] returns a [Ticket] as soon as it is called and
+// keeps running after the call completes. The task's status, partial output
+// and, once it is done, its result are served as a JSON resource at the
+// ticket's URI, and the session that started the task is sent a
+// resources/updated notification for that URI whenever the task changes.
+// The notifications are sent whether or not the client subscribed to the
+// resource. Clients cancel tasks with the cancel_task tool.
+//
+// A task belongs to the session that started it, or to the owner reported
+// by the function passed to [WithOwner]. Everyone else is told the task
+// doesn't exist. Finished tasks expire after a while; their state is kept in
+// a [Store]. Expired tasks are deleted when they are read, when a task
+// starts and by [Manager.Sweep].
+//
+//	m := tasks.New()
+//	tools, resources := mcp.NewToolRegistry(), mcp.NewResourceRegistry()
+//	m.Register(tools, resources)
+//	tasks.AddTool(m, tools, mcp.Tool{Name: "export"}, func(ctx context.Context, h *tasks.Handle, args exportArgs) (*mcp.CallToolResponse, error) {
+//		...
+//	})
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/riza-io/mcp-go"
+)
+
+// DefaultTTL is how long a finished task is kept unless [WithTTL] says
+// otherwise.
+const DefaultTTL = time.Hour
+
+// Status is the state of a task.
+type Status string
+
+const (
+	Working   Status = "working"
+	Completed Status = "completed"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// Task is the state of a task, as served at its resource URI.
+type Task struct {
+	ID     string `json:"id"`
+	Tool   string `json:"tool"`
+	Status Status `json:"status"`
+	// Output is the partial output reported with [Handle.Output].
+	Output []mcp.Content `json:"output,omitempty"`
+	// Result is the tool's result once the task has completed.
+	Result *mcp.CallToolResponse `json:"result,omitempty"`
+	// Error is the error message of a failed task.
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// ExpiresAt is when a finished task is deleted. It is nil while the
+	// task is working.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Owner identifies who started the task. It isn't served to clients,
+	// but a Store must keep it.
+	Owner string `json:"-"`
+}
+
+// A Ticket is the result of calling an asynchronous tool.
+type Ticket struct {
+	TaskID string `json:"taskId" description:"ID of the task running the tool"`
+	URI    string `json:"uri" description:"URI of the resource with the task's status and result"`
+	Status Status `json:"status" description:"status of the task"`
+}
+
+// A Func runs an asynchronous tool. Its context is cancelled when the task is
+// cancelled, but not when the call that started it completes.
+type Func[Args any] func(ctx context.Context, h *Handle, args Args) (*mcp.CallToolResponse, error)
+
+// A Manager runs tasks and serves their state.
+type Manager struct {
+	store   Store
+	ttl     time.Duration
+	baseURI string
+	owner   func(ctx context.Context) string
+	now     func() time.Time
+
+	mu      sync.Mutex // serializes updates to tasks
+	running map[string]context.CancelFunc
+}
+
+type Option interface {
+	apply(m *Manager)
+}
+
+type optionFunc func(m *Manager)
+
+func (f optionFunc) apply(m *Manager) {
+	f(m)
+}
+
+// WithStore keeps tasks in s instead of in memory.
+func WithStore(s Store) Option {
+	return optionFunc(func(m *Manager) {
+		m.store = s
+	})
+}
+
+// WithTTL sets how long a finished task can be read before it is deleted.
+func WithTTL(d time.Duration) Option {
+	return optionFunc(func(m *Manager) {
+		m.ttl = d
+	})
+}
+
+// WithBaseURI sets the URI that task IDs are appended to. It defaults to
+// "task://".
+func WithBaseURI(uri string) Option {
+	return optionFunc(func(m *Manager) {
+		m.baseURI = uri
+	})
+}
+
+// WithOwner sets how the owner of a task is worked out from the context of
+// the request that starts, reads or cancels it. By default a task belongs to
+// the session that started it. Use it, for example, to let every session of
+// a principal authenticated with the auth package share their tasks.
+func WithOwner(owner func(ctx context.Context) string) Option {
+	return optionFunc(func(m *Manager) {
+		m.owner = owner
+	})
+}
+
+// sessionOwner returns the ID of the request's session, or the empty string
+// outside a session.
+func sessionOwner(ctx context.Context) string {
+	if sess := mcp.SessionFromContext(ctx); sess != nil {
+		return sess.ID()
+	}
+	return ""
+}
+
+func New(opts ...Option) *Manager {
+	m := &Manager{
+		ttl:     DefaultTTL,
+		baseURI: "task://",
+		owner:   sessionOwner,
+		now:     time.Now,
+		running: map[string]context.CancelFunc{},
+	}
+	for _, opt := range opts {
+		opt.apply(m)
+	}
+	if m.store == nil {
+		m.store = NewMemoryStore()
+	}
+	return m
+}
+
+// Register adds the task status resource template to resources and the
+// cancel_task tool to tools.
+func (m *Manager) Register(tools *mcp.ToolRegistry, resources *mcp.ResourceRegistry) {
+	resources.AddResourceTemplate(mcp.ResourceTemplate{
+		URITemplate: m.baseURI + "{id}",
+		Name:        "task",
+		Description: "Status, partial output and result of a long-running tool call",
+		MimeType:    "application/json",
+	}, m.read)
+	mcp.AddTool(tools, mcp.Tool{
+		Name:        "cancel_task",
+		Description: "Cancel a running task",
+	}, func(ctx context.Context, args cancelArgs) (string, error) {
+		if err := m.Cancel(ctx, args.TaskID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return "", mcp.ProtocolError(mcp.NewError(mcp.CodeInvalidParams, fmt.Errorf("unknown task: %s", args.TaskID)))
+			}
+			if errors.Is(err, ErrNotRunningHere) {
+				return "", mcp.ProtocolError(mcp.NewError(mcp.CodeInvalidRequest, err))
+			}
+			return "", err
+		}
+		return "cancelled", nil
+	})
+}
+
+type cancelArgs struct {
+	TaskID string `json:"taskId" description:"ID of the task to cancel"`
+}
+
+// AddTool registers an asynchronous tool with r. Each call starts a task
+// that runs fn and returns a [Ticket] without waiting for it. Middleware
+// attached with opts wraps the call that starts the task.
+func AddTool[Args any](m *Manager, r *mcp.ToolRegistry, tool mcp.Tool, fn Func[Args], opts ...mcp.RegistrationOption) {
+	mcp.AddTool(r, tool, func(ctx context.Context, args Args) (Ticket, error) {
+		return m.start(ctx, tool.Name, func(ctx context.Context, h *Handle) (*mcp.CallToolResponse, error) {
+			return fn(ctx, h, args)
+		})
+	}, opts...)
+}
+
+// URI returns the URI of the resource for the task with the given ID.
+func (m *Manager) URI(id string) string {
+	return m.baseURI + id
+}
+
+// Get returns the task with the given ID, or ErrNotFound if it doesn't
+// exist, has expired or belongs to an owner other than the one of ctx.
+func (m *Manager) Get(ctx context.Context, id string) (*Task, error) {
+	t, err := m.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.Owner != m.owner(ctx) {
+		return nil, ErrNotFound
+	}
+	if t.expired(m.now()) {
+		if err := m.store.Delete(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+// ErrNotRunningHere is returned by [Manager.Cancel] for a working task that
+// another Manager sharing the store is running.
+var ErrNotRunningHere = errors.New("tasks: task is running on another manager")
+
+// Cancel cancels the context of a working task. The task's status becomes
+// cancelled once its function returns an error. Cancelling a finished task
+// has no effect. Like [Manager.Get], Cancel returns ErrNotFound for tasks of
+// other owners. Only the Manager that started a task can cancel it; others
+// return ErrNotRunningHere.
+func (m *Manager) Cancel(ctx context.Context, id string) error {
+	m.mu.Lock()
+	t, err := m.Get(ctx, id)
+	cancel, ok := m.running[id]
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if t.Status == Working {
+			return ErrNotRunningHere
+		}
+		return nil
+	}
+	cancel()
+	return nil
+}
+
+// Sweep deletes expired tasks every interval until ctx is done, so that
+// tasks nobody reads don't pile up in the store. It returns ctx.Err() once
+// ctx is done, or the first error from the store.
+func (m *Manager) Sweep(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := m.store.DeleteExpired(ctx, m.now()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (m *Manager) start(ctx context.Context, tool string, fn func(ctx context.Context, h *Handle) (*mcp.CallToolResponse, error)) (Ticket, error) {
+	now := m.now()
+	if err := m.store.DeleteExpired(ctx, now); err != nil {
+		return Ticket{}, err
+	}
+	t := &Task{
+		ID:        uuid.New().String(),
+		Tool:      tool,
+		Status:    Working,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Owner:     m.owner(ctx),
+	}
+	tctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	m.mu.Lock()
+	if err := m.store.Put(ctx, t); err != nil {
+		m.mu.Unlock()
+		cancel()
+		return Ticket{}, err
+	}
+	m.running[t.ID] = cancel
+	m.mu.Unlock()
+
+	h := &Handle{m: m, id: t.ID, session: mcp.SessionFromContext(ctx)}
+	go m.run(tctx, h, fn)
+	return Ticket{TaskID: t.ID, URI: m.URI(t.ID), Status: t.Status}, nil
+}
+
+func (m *Manager) run(ctx context.Context, h *Handle, fn func(ctx context.Context, h *Handle) (*mcp.CallToolResponse, error)) {
+	result, err := func() (result *mcp.CallToolResponse, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("panic: %v", v)
+			}
+		}()
+		return fn(ctx, h)
+	}()
+
+	// The task stays in running until its final state is stored, so that
+	// Cancel can tell it from a task another Manager is running.
+	defer func() {
+		m.mu.Lock()
+		m.running[h.id]()
+		delete(m.running, h.id)
+		m.mu.Unlock()
+	}()
+	m.mu.Lock()
+	cancelled := ctx.Err() != nil
+	m.mu.Unlock()
+
+	h.update(context.WithoutCancel(ctx), func(t *Task) {
+		switch {
+		case err != nil && cancelled:
+			t.Status = Cancelled
+		case err != nil:
+			t.Status = Failed
+			t.Error = err.Error()
+		default:
+			t.Status = Completed
+			t.Result = result
+		}
+		expires := m.now().Add(m.ttl)
+		t.ExpiresAt = &expires
+	})
+}
+
+func (m *Manager) read(ctx context.Context, uri string, vars map[string]string) ([]mcp.ResourceContent, error) {
+	t, err := m.Get(ctx, vars["id"])
+	if errors.Is(err, ErrNotFound) {
+		return nil, mcp.ResourceNotFound(uri)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bs, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContent{{URI: uri, MimeType: "application/json", Text: string(bs)}}, nil
+}
+
+// A Handle lets a running task report on its progress.
+type Handle struct {
+	m       *Manager
+	id      string
+	session *mcp.Session
+}
+
+// ID returns the task's ID.
+func (h *Handle) ID() string {
+	return h.id
+}
+
+// Output appends content to the task's partial output.
+func (h *Handle) Output(ctx context.Context, content ...mcp.Content) error {
+	return h.update(ctx, func(t *Task) {
+		t.Output = append(t.Output, content...)
+	})
+}
+
+// update applies fn to the stored task and tells the session that started
+// it that its resource has changed, without waiting for a subscription. The
+// notification is best-effort: the session may have ended, and the client
+// can still read the task, so failing to send it isn't an error.
+func (h *Handle) update(ctx context.Context, fn func(t *Task)) error {
+	h.m.mu.Lock()
+	t, err := h.m.store.Get(ctx, h.id)
+	if err == nil {
+		fn(t)
+		t.UpdatedAt = h.m.now()
+		err = h.m.store.Put(ctx, t)
+	}
+	h.m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if h.session != nil {
+		h.session.ResourceUpdated(ctx, h.m.URI(h.id))
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riza-io/mcp-go"
+)
+
+type args struct {
+	Fail bool `json:"fail"`
+}
+
+func setup(t *testing.T, opts ...Option) (*Manager, *mcp.ToolRegistry, *mcp.ResourceRegistry, chan struct{}) {
+	t.Helper()
+	m := New(opts...)
+	tools, resources := mcp.NewToolRegistry(), mcp.NewResourceRegistry()
+	m.Register(tools, resources)
+
+	release := make(chan struct{})
+	AddTool(m, tools, mcp.Tool{Name: "export"}, func(ctx context.Context, h *Handle, args args) (*mcp.CallToolResponse, error) {
+		if err := h.Output(ctx, mcp.Content{Type: "text", Text: "started"}); err != nil {
+			return nil, err
+		}
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if args.Fail {
+			return nil, errors.New("export failed")
+		}
+		return mcp.TextResult("done"), nil
+	})
+	return m, tools, resources, release
+}
+
+func start(t *testing.T, tools *mcp.ToolRegistry, a args) Ticket {
+	t.Helper()
+	raw, _ := json.Marshal(a)
+	resp, err := tools.CallTool(context.Background(), mcp.NewRequest(&mcp.CallToolRequest{Name: "export", Arguments: raw}))
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	var ticket Ticket
+	if err := json.Unmarshal(resp.Result.StructuredContent, &ticket); err != nil {
+		t.Fatalf("failed to decode ticket: %v", err)
+	}
+	return ticket
+}
+
+func read(t *testing.T, resources *mcp.ResourceRegistry, uri string) (*Task, error) {
+	t.Helper()
+	resp, err := resources.ReadResource(context.Background(), mcp.NewRequest(&mcp.ReadResourceRequest{URI: uri}))
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(resp.Result.Contents[0].Text), &task); err != nil {
+		t.Fatalf("failed to decode task: %v", err)
+	}
+	return &task, nil
+}
+
+// waitStatus polls the task's resource until it has left the working state.
+func waitStatus(t *testing.T, resources *mcp.ResourceRegistry, uri string) *Task {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		task, err := read(t, resources, uri)
+		if err != nil {
+			t.Fatalf("failed to read task: %v", err)
+		}
+		if task.Status != Working {
+			return task
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("task didn't finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	_, tools, resources, release := setup(t)
+	ticket := start(t, tools, args{})
+	if ticket.Status != Working || ticket.URI != "task://"+ticket.TaskID {
+		t.Fatalf("unexpected ticket: %+v", ticket)
+	}
+
+	close(release)
+	task := waitStatus(t, resources, ticket.URI)
+	if task.Status != Completed || task.Result == nil || task.Result.Content[0].Text != "done" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+	if len(task.Output) != 1 || task.Output[0].Text != "started" {
+		t.Fatalf("unexpected output: %+v", task.Output)
+	}
+	if task.ExpiresAt == nil {
+		t.Fatal("expected a finished task to expire")
+	}
+}
+
+func TestFail(t *testing.T) {
+	_, tools, resources, release := setup(t)
+	ticket := start(t, tools, args{Fail: true})
+	close(release)
+	if task := waitStatus(t, resources, ticket.URI); task.Status != Failed || task.Error != "export failed" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	_, tools, resources, _ := setup(t)
+	ticket := start(t, tools, args{})
+
+	raw, _ := json.Marshal(cancelArgs{TaskID: ticket.TaskID})
+	if _, err := tools.CallTool(context.Background(), mcp.NewRequest(&mcp.CallToolRequest{Name: "cancel_task", Arguments: raw})); err != nil {
+		t.Fatalf("failed to cancel task: %v", err)
+	}
+	if task := waitStatus(t, resources, ticket.URI); task.Status != Cancelled {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+
+	raw, _ = json.Marshal(cancelArgs{TaskID: "missing"})
+	_, err := tools.CallTool(context.Background(), mcp.NewRequest(&mcp.CallToolRequest{Name: "cancel_task", Arguments: raw}))
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+		t.Fatalf("expected invalid params, got %v", err)
+	}
+}
+
+func TestCancelOtherManager(t *testing.T) {
+	store := NewMemoryStore()
+	_, tools, resources, release := setup(t, WithStore(store))
+	other := New(WithStore(store))
+	ticket := start(t, tools, args{})
+
+	if err := other.Cancel(context.Background(), ticket.TaskID); !errors.Is(err, ErrNotRunningHere) {
+		t.Fatalf("expected ErrNotRunningHere, got %v", err)
+	}
+	close(release)
+	if task := waitStatus(t, resources, ticket.URI); task.Status != Completed {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+	if err := other.Cancel(context.Background(), ticket.TaskID); err != nil {
+		t.Fatalf("failed to cancel a finished task: %v", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Now()
+	m, tools, resources, release := setup(t, WithTTL(time.Minute))
+	m.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	ticket := start(t, tools, args{})
+	close(release)
+	waitStatus(t, resources, ticket.URI)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	swept := make(chan error, 1)
+	go func() { swept <- m.Sweep(ctx, time.Millisecond) }()
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := m.store.Get(context.Background(), ticket.TaskID); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired task was not swept")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-swept; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	var mu sync.Mutex
+	now := time.Now()
+	m, tools, resources, release := setup(t, WithTTL(time.Minute))
+	m.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	ticket := start(t, tools, args{})
+	close(release)
+	waitStatus(t, resources, ticket.URI)
+
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	_, err := read(t, resources, ticket.URI)
+	var rpcErr *mcp.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeResourceNotFound {
+		t.Fatalf("expected resource not found, got %v", err)
+	}
+	if _, err := m.store.Get(context.Background(), ticket.TaskID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the expired task to be deleted, got %v", err)
+	}
+}
+
+type ownerKey struct{}
+
+func TestOwner(t *testing.T) {
+	_, tools, resources, release := setup(t, WithOwner(func(ctx context.Context) string {
+		owner, _ := ctx.Value(ownerKey{}).(string)
+		return owner
+	}))
+	alice := context.WithValue(context.Background(), ownerKey{}, "alice")
+	bob := context.WithValue(context.Background(), ownerKey{}, "bob")
+
+	resp, err := tools.CallTool(alice, mcp.NewRequest(&mcp.CallToolRequest{Name: "export", Arguments: json.RawMessage(`{}`)}))
+	if err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	var ticket Ticket
+	if err := json.Unmarshal(resp.Result.StructuredContent, &ticket); err != nil {
+		t.Fatalf("failed to decode ticket: %v", err)
+	}
+
+	var rpcErr *mcp.Error
+	_, err = resources.ReadResource(bob, mcp.NewRequest(&mcp.ReadResourceRequest{URI: ticket.URI}))
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeResourceNotFound {
+		t.Fatalf("bob read alice's task: got %v, want resource not found", err)
+	}
+	raw, _ := json.Marshal(cancelArgs{TaskID: ticket.TaskID})
+	_, err = tools.CallTool(bob, mcp.NewRequest(&mcp.CallToolRequest{Name: "cancel_task", Arguments: raw}))
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != mcp.CodeInvalidParams {
+		t.Fatalf("bob cancelled alice's task: got %v, want invalid params", err)
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, err := resources.ReadResource(alice, mcp.NewRequest(&mcp.ReadResourceRequest{URI: ticket.URI}))
+		if err != nil {
+			t.Fatalf("alice failed to read her task: %v", err)
+		}
+		var task Task
+		if err := json.Unmarshal([]byte(resp.Result.Contents[0].Text), &task); err != nil {
+			t.Fatalf("failed to decode task: %v", err)
+		}
+		if task.Status == Completed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected task: %+v", task)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// timeouts holds a default timeout and per-method overrides. A zero duration
+// means no timeout.
+type timeouts struct {
+	fallback time.Duration
+	methods  map[Method]time.Duration
+}
+
+func (t *timeouts) set(method Method, d time.Duration) {
+	if method == "" {
+		t.fallback = d
+		return
+	}
+	if t.methods == nil {
+		t.methods = map[Method]time.Duration{}
+	}
+	t.methods[method] = d
+}
+
+func (t timeouts) get(method Method) time.Duration {
+	if d, ok := t.methods[method]; ok {
+		return d
+	}
+	return t.fallback
+}
+
+// withTimeout returns a context that ends after the timeout for method.
+func (t timeouts) withTimeout(ctx context.Context, method Method) (context.Context, context.CancelFunc) {
+	if d := t.get(method); d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
+
+// errCancelledByPeer is the cause of a handler context the peer cancelled
+// with a cancellation notification.
+var errCancelledByPeer = errors.New("request cancelled by peer")
+
+// timeoutError returns the error reported for a request to method whose
+// context ended with err.
+func timeoutError(method string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewError(CodeRequestTimeout, fmt.Errorf("%s: %w", method, err))
+	}
+	return err
+}
+
+// handlerKey identifies an incoming request being handled.
+type handlerKey struct {
+	session string
+	id      string
+}
+
+// handlers tracks the incoming requests being handled so that the peer can
+// cancel them.
+type handlers struct {
+	mu      sync.Mutex
+	cancels map[handlerKey]context.CancelCauseFunc
+}
+
+// start returns a context for handling the request msg that is cancelled
+// when the peer cancels the request, and a function to call once the
+// request is done.
+func (h *handlers) start(ctx context.Context, msg *Message) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := handlerKey{msg.Metadata["session_id"], msg.ID.String()}
+	h.mu.Lock()
+	if h.cancels == nil {
+		h.cancels = map[handlerKey]context.CancelCauseFunc{}
+	}
+	h.cancels[key] = cancel
+	h.mu.Unlock()
+	return ctx, func() {
+		h.mu.Lock()
+		delete(h.cancels, key)
+		h.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel cancels the request named by the cancellation notification msg.
+func (h *handlers) cancel(msg *Message) {
+	var params CancelledNotification
+	if msg.Params == nil || json.Unmarshal(*msg.Params, &params) != nil {
+		return
+	}
+	key := handlerKey{msg.Metadata["session_id"], params.RequestID.String()}
+	h.mu.Lock()
+	cancel, ok := h.cancels[key]
+	h.mu.Unlock()
+	if ok {
+		cancel(errCancelledByPeer)
+	}
+}
+
+// cancelAll cancels every request being handled.
+func (h *handlers) cancelAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, cancel := range h.cancels {
+		cancel(context.Canceled)
+	}
+}
@@ -0,0 +1,402 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/riza-io/mcp-go/jsonschema"
+)
+
+// A ToolFunc handles a call to a tool registered with [AddTool]. Args is
+// decoded from the call's arguments; Result is converted into a
+// [CallToolResponse]:
+//
+//   - *CallToolResponse is returned as is
+//   - string becomes a single text content item
+//   - []Content and Content are used as the response content
+//   - anything else is encoded as JSON into a single text content item and,
+//     if it encodes to a JSON object, also sent as structured content
+type ToolFunc[Args, Result any] func(ctx context.Context, args Args) (Result, error)
+
+// A ToolRegistry serves tools/list and tools/call from a set of typed tool
+// handlers. Register tools with [AddTool] and pass the registry to a server
+// with [WithToolRegistry].
+//
+// Tools can be added, removed, enabled and disabled while the server runs,
+// for every session or for one. Sessions don't see disabled tools, and the
+// server sends a tools/list_changed notification to every session whose list
+// of tools changes.
+type ToolRegistry struct {
+	mu         sync.RWMutex
+	tools      []*registeredTool
+	middleware middlewareSet
+	list       listState
+}
+
+type registeredTool struct {
+	tool         Tool
+	schema       *jsonschema.Schema
+	outputSchema *jsonschema.Schema
+	registration registration
+	decode       func(args json.RawMessage) (any, error)
+	call         func(ctx context.Context, args any) (any, error)
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{}
+}
+
+// AddTool registers a tool with the registry, replacing any tool with the
+// same name. Options attach tags and [Middleware] to the tool; the tool is
+// enabled unless [WithDisabled] is given.
+//
+// If tool.InputSchema is empty it is generated from Args, which must be a
+// struct type, using [jsonschema.Reflect]. Likewise, if tool.OutputSchema is
+// empty and Result is a struct type other than [CallToolResponse] or
+// [Content], the output schema is generated from Result. AddTool panics if a
+// schema can't be generated or isn't a valid schema.
+func AddTool[Args, Result any](r *ToolRegistry, tool Tool, handler ToolFunc[Args, Result], opts ...RegistrationOption) {
+	args := reflect.TypeFor[Args]()
+	if args.Kind() == reflect.Pointer {
+		args = args.Elem()
+	}
+	if len(tool.InputSchema) == 0 && args.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("mcp: arguments for tool %s must be a struct, got %s", tool.Name, args))
+	}
+	var schema *jsonschema.Schema
+	tool.InputSchema, schema = toolSchema(tool.Name, "input", tool.InputSchema, args)
+
+	var outputSchema *jsonschema.Schema
+	result := reflect.TypeFor[Result]()
+	if result.Kind() == reflect.Pointer {
+		result = result.Elem()
+	}
+	if len(tool.OutputSchema) > 0 || result.Kind() == reflect.Struct &&
+		result != reflect.TypeFor[CallToolResponse]() && result != reflect.TypeFor[Content]() {
+		tool.OutputSchema, outputSchema = toolSchema(tool.Name, "output", tool.OutputSchema, result)
+	}
+
+	r.add(&registeredTool{
+		tool:         tool,
+		schema:       schema,
+		outputSchema: outputSchema,
+		registration: newRegistration(opts),
+		decode: func(raw json.RawMessage) (any, error) {
+			var args Args
+			// Handlers taking a pointer get an empty value, not nil, when
+			// the call has no arguments.
+			if t := reflect.TypeFor[Args](); t.Kind() == reflect.Pointer {
+				args = reflect.New(t.Elem()).Interface().(Args)
+			}
+			if len(raw) > 0 && string(raw) != "null" {
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, ProtocolError(NewError(CodeInvalidParams, fmt.Errorf("invalid arguments for tool %s: %w", tool.Name, err)))
+				}
+			}
+			return args, nil
+		},
+		call: func(ctx context.Context, raw any) (any, error) {
+			args, ok := raw.(Args)
+			if !ok {
+				return nil, ProtocolError(NewError(CodeInternalError, fmt.Errorf("middleware replaced arguments for tool %s with %T", tool.Name, raw)))
+			}
+			return handler(ctx, args)
+		},
+	})
+}
+
+// toolSchema parses a schema given in a tool definition, or generates one from
+// t if none was given.
+func toolSchema(tool, kind string, raw json.RawMessage, t reflect.Type) (json.RawMessage, *jsonschema.Schema) {
+	schema := new(jsonschema.Schema)
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, schema); err != nil {
+			panic(fmt.Sprintf("mcp: %s schema for tool %s: %v", kind, tool, err))
+		}
+		return raw, schema
+	}
+	schema, err := jsonschema.Reflect(t)
+	if err != nil {
+		panic(fmt.Sprintf("mcp: %s schema for tool %s: %v", kind, tool, err))
+	}
+	raw, err = json.Marshal(schema)
+	if err != nil {
+		panic(fmt.Sprintf("mcp: %s schema for tool %s: %v", kind, tool, err))
+	}
+	return raw, schema
+}
+
+func (r *ToolRegistry) add(t *registeredTool) {
+	name := t.tool.Name
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, t.registration.disabled)
+		if i := r.index(name); i >= 0 {
+			r.tools[i] = t
+			return true
+		}
+		r.tools = append(r.tools, t)
+		return false
+	})
+}
+
+// RemoveTool removes the named tool from the registry.
+func (r *ToolRegistry) RemoveTool(name string) {
+	r.update(name, func() bool {
+		if i := r.index(name); i >= 0 {
+			r.tools = slices.Delete(r.tools, i, i+1)
+		}
+		r.list.visibility.remove(name)
+		return false
+	})
+}
+
+// EnableTool shows the named tool to every session, except those it was
+// disabled for with [ToolRegistry.DisableToolFor].
+func (r *ToolRegistry) EnableTool(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, false)
+		return false
+	})
+}
+
+// DisableTool hides the named tool from every session, except those it was
+// enabled for with [ToolRegistry.EnableToolFor].
+func (r *ToolRegistry) DisableTool(name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setDisabled(name, true)
+		return false
+	})
+}
+
+// EnableToolFor shows the named tool to one session, whether or not it is
+// enabled for the others. Sessions that have ended are ignored.
+func (r *ToolRegistry) EnableToolFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, true)
+		return false
+	})
+}
+
+// DisableToolFor hides the named tool from one session, whether or not it
+// is enabled for the others.
+func (r *ToolRegistry) DisableToolFor(s *Session, name string) {
+	r.update(name, func() bool {
+		r.list.visibility.setEnabledFor(s, name, false)
+		return false
+	})
+}
+
+func (r *ToolRegistry) update(name string, fn func() bool) {
+	r.list.update(&r.mu, name, func() bool { return r.index(name) >= 0 }, fn)
+}
+
+// index returns the position of the named tool, or -1. The caller must hold
+// r.mu.
+func (r *ToolRegistry) index(name string) int {
+	return slices.IndexFunc(r.tools, func(t *registeredTool) bool {
+		return t.tool.Name == name
+	})
+}
+
+func (r *ToolRegistry) lookup(name string) (*registeredTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.index(name); i >= 0 {
+		return r.tools[i], true
+	}
+	return nil, false
+}
+
+// lookupFor returns the named tool if the session of ctx can see it.
+func (r *ToolRegistry) lookupFor(ctx context.Context, name string) (*registeredTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.index(name); i >= 0 && r.list.visibility.visible(SessionFromContext(ctx), name) {
+		return r.tools[i], true
+	}
+	return nil, false
+}
+
+// ListTools returns the tools the session can see in registration order.
+func (r *ToolRegistry) ListTools(ctx context.Context, req *Request[ListToolsRequest]) (*Response[ListToolsResponse], error) {
+	sess := SessionFromContext(ctx)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tools := make([]Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		if r.list.visibility.visible(sess, t.tool.Name) {
+			tools = append(tools, t.tool)
+		}
+	}
+	return NewResponse(&ListToolsResponse{
+		Tools: tools,
+	}), nil
+}
+
+// CallTool decodes the arguments and calls the named tool. Unknown and
+// disabled tools and arguments that can't be decoded are reported as invalid
+// params.
+func (r *ToolRegistry) CallTool(ctx context.Context, req *Request[CallToolRequest]) (*Response[CallToolResponse], error) {
+	t, ok := r.lookupFor(ctx, req.Params.Name)
+	if !ok {
+		return nil, ProtocolError(NewError(CodeInvalidParams, fmt.Errorf("unknown tool: %s", req.Params.Name)))
+	}
+	args, err := t.decode(req.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+	inv := &Invocation{Kind: ToolInvocation, Name: t.tool.Name, Args: args, Request: req}
+	result, err := r.middleware.invoke(ctx, t.registration, inv, func(ctx context.Context, inv *Invocation) (any, error) {
+		return t.call(ctx, inv.Args)
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := toolResponse(result)
+	if err != nil {
+		return nil, err
+	}
+	return NewResponse(resp), nil
+}
+
+// Use adds middleware that wraps calls to every tool in the registry.
+func (r *ToolRegistry) Use(mw ...Middleware) {
+	r.middleware.use(mw)
+}
+
+// UseTag adds middleware that wraps calls to every tool tagged with tag.
+func (r *ToolRegistry) UseTag(tag string, mw ...Middleware) {
+	r.middleware.useTag(tag, mw)
+}
+
+// validateArguments checks the arguments of a call against the input schema
+// of the named tool. Calls to unknown or disabled tools are left to CallTool.
+func (r *ToolRegistry) validateArguments(ctx context.Context, req *CallToolRequest) error {
+	t, ok := r.lookupFor(ctx, req.Name)
+	if !ok {
+		return nil
+	}
+	args := req.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	if err := t.schema.ValidateJSON(args); err != nil {
+		rpcErr := NewError(CodeInvalidParams, fmt.Errorf("invalid arguments for tool %s: %w", req.Name, err))
+		var verr *jsonschema.ValidationError
+		if errors.As(err, &verr) {
+			rpcErr = rpcErr.WithData(verr)
+		}
+		return rpcErr
+	}
+	return nil
+}
+
+// toolArgumentValidator returns an interceptor that validates tools/call
+// arguments against the registry's input schemas before dispatch.
+func toolArgumentValidator(r *ToolRegistry) Interceptor {
+	return UnaryInterceptorFunc(func(next UnaryFunc) UnaryFunc {
+		return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			if req, ok := request.Any().(*CallToolRequest); ok && request.Method() == string(MethodCallTool) {
+				if err := r.validateArguments(ctx, req); err != nil {
+					return nil, err
+				}
+			}
+			return next(ctx, request)
+		}
+	})
+}
+
+// validateOutput checks the structured content of a successful tool result
+// against the output schema of the named tool.
+func (r *ToolRegistry) validateOutput(name string, resp *CallToolResponse) error {
+	t, ok := r.lookup(name)
+	if !ok || t.outputSchema == nil || resp.IsError {
+		return nil
+	}
+	if err := validateStructuredContent(t.outputSchema, resp); err != nil {
+		return NewError(CodeInternalError, fmt.Errorf("invalid result from tool %s: %w", name, err))
+	}
+	return nil
+}
+
+// ToolOutputError is returned by [Client.CallTool] when a tool's structured
+// result doesn't conform to its output schema.
+type ToolOutputError struct {
+	Tool string
+	Err  *jsonschema.ValidationError
+}
+
+func (e *ToolOutputError) Error() string {
+	return fmt.Sprintf("invalid result from tool %s: %v", e.Tool, e.Err)
+}
+
+func (e *ToolOutputError) Unwrap() error {
+	return e.Err
+}
+
+func validateStructuredContent(schema *jsonschema.Schema, resp *CallToolResponse) *jsonschema.ValidationError {
+	if len(resp.StructuredContent) == 0 {
+		return &jsonschema.ValidationError{Errors: []jsonschema.FieldError{{
+			Message: "structured content is required by the output schema",
+		}}}
+	}
+	err := schema.ValidateJSON(resp.StructuredContent)
+	if err == nil {
+		return nil
+	}
+	var verr *jsonschema.ValidationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+	return &jsonschema.ValidationError{Errors: []jsonschema.FieldError{{
+		Message: fmt.Sprintf("structured content is not valid JSON: %v", err),
+	}}}
+}
+
+// toolOutputValidator returns an interceptor that validates the structured
+// content of tools/call results against the registry's output schemas.
+func toolOutputValidator(r *ToolRegistry) Interceptor {
+	return UnaryInterceptorFunc(func(next UnaryFunc) UnaryFunc {
+		return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+			resp, err := next(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			req, ok := request.Any().(*CallToolRequest)
+			if !ok || request.Method() != string(MethodCallTool) {
+				return resp, nil
+			}
+			if result, ok := resp.Any().(*CallToolResponse); ok && result != nil {
+				if err := r.validateOutput(req.Name, result); err != nil {
+					return nil, err
+				}
+			}
+			return resp, nil
+		}
+	})
+}
+
+func toolResponse(result any) (*CallToolResponse, error) {
+	switch r := result.(type) {
+	case *CallToolResponse:
+		if r == nil {
+			return &CallToolResponse{Content: []Content{}}, nil
+		}
+		return r, nil
+	case CallToolResponse:
+		return &r, nil
+	case string:
+		return TextResult(r), nil
+	case []Content:
+		return &CallToolResponse{Content: r}, nil
+	case Content:
+		return &CallToolResponse{Content: []Content{r}}, nil
+	default:
+		return JSONResult(r)
+	}
+}
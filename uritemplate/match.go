@@ -0,0 +1,189 @@
+package uritemplate
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// group describes what a capture group of the match expression holds.
+type group struct {
+	op  operator
+	v   varspec
+	all *expression // set for query expressions, which capture as a whole
+}
+
+// Match reports whether uri could be produced by expanding the template and,
+// if so, returns the values of the variables it contains. Values are percent
+// decoded. Variables that don't appear in the URI are left out.
+//
+// Lists and exploded variables are returned as a single string with their
+// items joined by the expression's separator, so {/path*} matching "/a/b"
+// yields "a/b" and {list} matching "x,y" yields "x,y". Query expressions
+// ({?x,y} and {&x}) match their parameters in any order; an exploded query
+// variable also picks up parameters that don't name any other variable.
+//
+// Matching is not always unambiguous: when several undelimited variables are
+// adjacent the earlier ones match as much as possible.
+func (t *Template) Match(uri string) (map[string]string, bool) {
+	m := t.re.FindStringSubmatchIndex(uri)
+	if m == nil {
+		return nil, false
+	}
+
+	values := map[string]string{}
+	var query []string
+	var queryExprs []*expression
+	for i, g := range t.groups {
+		if g.all != nil {
+			queryExprs = append(queryExprs, g.all)
+		}
+		start, end := m[2*i+2], m[2*i+3]
+		if start < 0 {
+			continue
+		}
+		s := uri[start:end]
+		if g.all != nil {
+			if s != "" {
+				query = append(query, strings.Split(s[1:], "&")...)
+			}
+			continue
+		}
+		if g.v.explode && !g.op.named && g.op.sep != "," {
+			items := strings.Split(s, g.op.sep)
+			for j, item := range items {
+				items[j] = unescape(item)
+			}
+			values[g.v.name] = strings.Join(items, g.op.sep)
+			continue
+		}
+		if g.op.named {
+			s = strings.TrimPrefix(s, ";"+g.v.name)
+			s = strings.TrimPrefix(s, "=")
+			if g.v.explode {
+				s = strings.ReplaceAll(s, ";"+g.v.name+"=", ",")
+			}
+		}
+		values[g.v.name] = unescape(s)
+	}
+	if len(queryExprs) > 0 {
+		matchQuery(values, query, queryExprs)
+	}
+	return values, true
+}
+
+func matchQuery(values map[string]string, pairs []string, exprs []*expression) {
+	declared := map[string]varspec{}
+	explode := ""
+	for _, e := range exprs {
+		for _, v := range e.vars {
+			declared[v.name] = v
+			if v.explode && explode == "" {
+				explode = v.name
+			}
+		}
+	}
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		k, v = unescape(k), unescape(v)
+		if spec, ok := declared[k]; ok {
+			if prev, ok := values[k]; ok && spec.explode {
+				v = prev + "," + v
+			}
+			values[k] = v
+		} else if explode != "" {
+			values[k] = v
+		}
+	}
+}
+
+func unescape(s string) string {
+	if u, err := url.PathUnescape(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// compile builds a regular expression that matches the template's
+// expansions.
+func (t *Template) compile() (*regexp.Regexp, []group) {
+	var b strings.Builder
+	var groups []group
+	b.WriteString("^")
+	for _, p := range t.parts {
+		if p.expr == nil {
+			b.WriteString(regexp.QuoteMeta(p.literal))
+			continue
+		}
+		e := p.expr
+		switch e.op.char {
+		case '?', '&':
+			b.WriteString("(" + regexp.QuoteMeta(e.op.first) + "[^#]*)?")
+			groups = append(groups, group{op: e.op, all: e})
+		case ';':
+			for _, v := range e.vars {
+				name := regexp.QuoteMeta(v.name)
+				if v.explode {
+					b.WriteString("((?:;" + name + "(?:=[^;/?#]*)?)*)")
+				} else {
+					b.WriteString("(;" + name + "(?:=" + class(e.op, len(e.vars), v) + ")?)?")
+				}
+				groups = append(groups, group{op: e.op, v: v})
+			}
+		default:
+			b.WriteString("(?:" + regexp.QuoteMeta(e.op.first))
+			for i, v := range e.vars {
+				if i > 0 {
+					b.WriteString("(?:" + regexp.QuoteMeta(e.op.sep))
+				}
+				b.WriteString("(" + class(e.op, len(e.vars), v) + ")")
+				if i > 0 {
+					b.WriteString(")?")
+				}
+				groups = append(groups, group{op: e.op, v: v})
+			}
+			b.WriteString(")?")
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String()), groups
+}
+
+// class returns the pattern for a single variable's value. Values never
+// contain the expression's separator unless the variable is a list that is
+// alone in its expression.
+func class(op operator, nvars int, v varspec) string {
+	var excluded string
+	switch op.char {
+	case '+':
+		excluded = "?#"
+	case '#':
+		excluded = ""
+	case ';':
+		excluded = ";/?#"
+	default:
+		excluded = "/?#"
+	}
+	if op.char != ';' && (nvars > 1 || v.explode) && !strings.Contains(excluded, op.sep) {
+		excluded += op.sep
+	}
+	if op.char == '.' {
+		excluded += "."
+	}
+	c := "."
+	if excluded != "" {
+		c = "[^" + regexp.QuoteMeta(excluded) + "]"
+	}
+	if v.explode {
+		sep := regexp.QuoteMeta(op.sep)
+		return c + "*(?:" + sep + c + "*)*"
+	}
+	if v.prefix > 0 {
+		return c + "{0," + strconv.Itoa(v.prefix) + "}"
+	}
+	return c + "*"
+}
@@ -0,0 +1,331 @@
+// Package uritemplate implements URI templates as defined by RFC 6570.
+//
+// Templates can be expanded at all four levels of the RFC. They can also be
+// matched against URIs to recover variable values, which is how resource
+// templates are resolved.
+package uritemplate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Template is a parsed URI template.
+type Template struct {
+	raw   string
+	parts []part
+
+	re     *regexp.Regexp
+	groups []group
+}
+
+// part is either a literal or an expression.
+type part struct {
+	literal string
+	expr    *expression
+}
+
+type expression struct {
+	op   operator
+	vars []varspec
+}
+
+type varspec struct {
+	name    string
+	explode bool
+	prefix  int
+}
+
+// operator describes the expansion behavior of an expression operator, as
+// laid out in appendix A of RFC 6570.
+type operator struct {
+	char     byte
+	first    string
+	sep      string
+	named    bool
+	ifEmpty  string
+	reserved bool
+}
+
+var operators = map[byte]operator{
+	0:   {0, "", ",", false, "", false},
+	'+': {'+', "", ",", false, "", true},
+	'.': {'.', ".", ".", false, "", false},
+	'/': {'/', "/", "/", false, "", false},
+	';': {';', ";", ";", true, "", false},
+	'?': {'?', "?", "&", true, "=", false},
+	'&': {'&', "&", "&", true, "=", false},
+	'#': {'#', "#", ",", false, "", true},
+}
+
+// Parse parses a URI template.
+func Parse(s string) (*Template, error) {
+	t := &Template{raw: s}
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			if strings.IndexByte(s, '}') >= 0 {
+				return nil, fmt.Errorf("uritemplate: unexpected '}' in %q", t.raw)
+			}
+			t.parts = append(t.parts, part{literal: s})
+			break
+		}
+		if i > 0 {
+			if strings.IndexByte(s[:i], '}') >= 0 {
+				return nil, fmt.Errorf("uritemplate: unexpected '}' in %q", t.raw)
+			}
+			t.parts = append(t.parts, part{literal: s[:i]})
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("uritemplate: unterminated expression in %q", t.raw)
+		}
+		expr, err := parseExpression(s[i+1 : i+j])
+		if err != nil {
+			return nil, fmt.Errorf("uritemplate: %w in %q", err, t.raw)
+		}
+		t.parts = append(t.parts, part{expr: expr})
+		s = s[i+j+1:]
+	}
+	t.re, t.groups = t.compile()
+	return t, nil
+}
+
+// MustParse is like [Parse] but panics if the template is invalid.
+func MustParse(s string) *Template {
+	t, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+var varnameRe = regexp.MustCompile(`^(?:[A-Za-z0-9_]|%[0-9A-Fa-f]{2})(?:\.?(?:[A-Za-z0-9_]|%[0-9A-Fa-f]{2}))*$`)
+
+func parseExpression(s string) (*expression, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	expr := &expression{op: operators[0]}
+	if op, ok := operators[s[0]]; ok && s[0] != 0 {
+		expr.op = op
+		s = s[1:]
+	} else if strings.ContainsRune("=,!@|", rune(s[0])) {
+		return nil, fmt.Errorf("reserved operator %q", s[0])
+	}
+	for _, spec := range strings.Split(s, ",") {
+		v := varspec{name: spec}
+		if name, ok := strings.CutSuffix(spec, "*"); ok {
+			v.name, v.explode = name, true
+		} else if name, prefix, ok := strings.Cut(spec, ":"); ok {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n <= 0 || n >= 10000 {
+				return nil, fmt.Errorf("invalid prefix %q", prefix)
+			}
+			v.name, v.prefix = name, n
+		}
+		if !varnameRe.MatchString(v.name) {
+			return nil, fmt.Errorf("invalid variable name %q", v.name)
+		}
+		expr.vars = append(expr.vars, v)
+	}
+	return expr, nil
+}
+
+// String returns the template source.
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Varnames returns the names of the template's variables in order of
+// appearance.
+func (t *Template) Varnames() []string {
+	var names []string
+	for _, p := range t.parts {
+		if p.expr == nil {
+			continue
+		}
+		for _, v := range p.expr.vars {
+			if !slices.Contains(names, v.name) {
+				names = append(names, v.name)
+			}
+		}
+	}
+	return names
+}
+
+// Expand expands the template with the given variables. A value may be a
+// string, a []string list, a map[string]string associative array (expanded
+// in key order) or any other value, which is formatted with fmt.Sprint.
+// Missing variables, nil values and empty lists are undefined and omitted.
+func (t *Template) Expand(vars map[string]any) (string, error) {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.expr == nil {
+			b.WriteString(p.literal)
+			continue
+		}
+		if err := p.expr.expand(&b, vars); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+func (e *expression) expand(b *strings.Builder, vars map[string]any) error {
+	first := true
+	for _, v := range e.vars {
+		value, ok := vars[v.name]
+		if !ok || value == nil {
+			continue
+		}
+		var s string
+		switch value := value.(type) {
+		case string:
+			s = e.expandString(v, value)
+		case []string:
+			if len(value) == 0 {
+				continue
+			}
+			s = e.expandList(v, value)
+		case map[string]string:
+			if len(value) == 0 {
+				continue
+			}
+			s = e.expandMap(v, value)
+		default:
+			s = e.expandString(v, fmt.Sprint(value))
+		}
+		if first {
+			b.WriteString(e.op.first)
+			first = false
+		} else {
+			b.WriteString(e.op.sep)
+		}
+		b.WriteString(s)
+	}
+	return nil
+}
+
+func (e *expression) expandString(v varspec, value string) string {
+	var b strings.Builder
+	if e.op.named {
+		b.WriteString(v.name)
+		if value == "" {
+			b.WriteString(e.op.ifEmpty)
+			return b.String()
+		}
+		b.WriteByte('=')
+	}
+	if v.prefix > 0 && utf8.RuneCountInString(value) > v.prefix {
+		value = string([]rune(value)[:v.prefix])
+	}
+	b.WriteString(encode(value, e.op.reserved))
+	return b.String()
+}
+
+func (e *expression) expandList(v varspec, values []string) string {
+	var b strings.Builder
+	if !v.explode {
+		if e.op.named {
+			b.WriteString(v.name)
+			b.WriteByte('=')
+		}
+		for i, value := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(encode(value, e.op.reserved))
+		}
+		return b.String()
+	}
+	for i, value := range values {
+		if i > 0 {
+			b.WriteString(e.op.sep)
+		}
+		if e.op.named {
+			b.WriteString(v.name)
+			if value == "" {
+				b.WriteString(e.op.ifEmpty)
+				continue
+			}
+			b.WriteByte('=')
+		}
+		b.WriteString(encode(value, e.op.reserved))
+	}
+	return b.String()
+}
+
+func (e *expression) expandMap(v varspec, values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	if !v.explode {
+		if e.op.named {
+			b.WriteString(v.name)
+			b.WriteByte('=')
+		}
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(encode(k, e.op.reserved))
+			b.WriteByte(',')
+			b.WriteString(encode(values[k], e.op.reserved))
+		}
+		return b.String()
+	}
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(e.op.sep)
+		}
+		b.WriteString(encode(k, e.op.reserved))
+		if values[k] == "" && e.op.named {
+			b.WriteString(e.op.ifEmpty)
+			continue
+		}
+		b.WriteByte('=')
+		b.WriteString(encode(values[k], e.op.reserved))
+	}
+	return b.String()
+}
+
+const reservedChars = ":/?#[]@!$&'()*+,;="
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// encode percent-encodes a value. Reserved expansion also passes through
+// reserved characters and existing percent-encoded triplets.
+func encode(s string, reserved bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isUnreserved(c):
+			b.WriteByte(c)
+		case reserved && strings.IndexByte(reservedChars, c) >= 0:
+			b.WriteByte(c)
+		case reserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,194 @@
+package uritemplate
+
+import (
+	"maps"
+	"testing"
+)
+
+// Variables from section 3.2 of RFC 6570.
+var rfcVars = map[string]any{
+	"count":      []string{"one", "two", "three"},
+	"dom":        []string{"example", "com"},
+	"dub":        "me/too",
+	"hello":      "Hello World!",
+	"half":       "50%",
+	"var":        "value",
+	"who":        "fred",
+	"base":       "http://example.com/home/",
+	"path":       "/foo/bar",
+	"list":       []string{"red", "green", "blue"},
+	"keys":       map[string]string{"semi": ";", "dot": ".", "comma": ","},
+	"v":          "6",
+	"x":          "1024",
+	"y":          "768",
+	"empty":      "",
+	"empty_keys": map[string]string{},
+	"undef":      nil,
+}
+
+func TestExpand(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		want     string
+	}{
+		// Level 1
+		{"{var}", "value"},
+		{"{hello}", "Hello%20World%21"},
+		// Level 2
+		{"{+var}", "value"},
+		{"{+hello}", "Hello%20World!"},
+		{"{+path}/here", "/foo/bar/here"},
+		{"here?ref={+path}", "here?ref=/foo/bar"},
+		{"X{#var}", "X#value"},
+		{"X{#hello}", "X#Hello%20World!"},
+		// Level 3
+		{"map?{x,y}", "map?1024,768"},
+		{"{x,hello,y}", "1024,Hello%20World%21,768"},
+		{"{+x,hello,y}", "1024,Hello%20World!,768"},
+		{"{+path,x}/here", "/foo/bar,1024/here"},
+		{"{#x,hello,y}", "#1024,Hello%20World!,768"},
+		{"X{.var}", "X.value"},
+		{"X{.x,y}", "X.1024.768"},
+		{"{/var}", "/value"},
+		{"{/var,x}/here", "/value/1024/here"},
+		{"{;x,y}", ";x=1024;y=768"},
+		{"{;x,y,empty}", ";x=1024;y=768;empty"},
+		{"{?x,y}", "?x=1024&y=768"},
+		{"{?x,y,empty}", "?x=1024&y=768&empty="},
+		{"?fixed=yes{&x}", "?fixed=yes&x=1024"},
+		{"{&x,y,empty}", "&x=1024&y=768&empty="},
+		// Level 4
+		{"{var:3}", "val"},
+		{"{var:30}", "value"},
+		{"{list}", "red,green,blue"},
+		{"{list*}", "red,green,blue"},
+		{"{keys}", "comma,%2C,dot,.,semi,%3B"},
+		{"{keys*}", "comma=%2C,dot=.,semi=%3B"},
+		{"{+path:6}/here", "/foo/b/here"},
+		{"{+list}", "red,green,blue"},
+		{"{+keys*}", "comma=,,dot=.,semi=;"},
+		{"{#path:6}/here", "#/foo/b/here"},
+		{"X{.list*}", "X.red.green.blue"},
+		{"{/var:1,var}", "/v/value"},
+		{"{/list*}", "/red/green/blue"},
+		{"{/list*,path:4}", "/red/green/blue/%2Ffoo"},
+		{"{;hello:5}", ";hello=Hello"},
+		{"{;list*}", ";list=red;list=green;list=blue"},
+		{"{;keys*}", ";comma=%2C;dot=.;semi=%3B"},
+		{"{?var:3}", "?var=val"},
+		{"{?list}", "?list=red,green,blue"},
+		{"{?list*}", "?list=red&list=green&list=blue"},
+		{"{?keys*}", "?comma=%2C&dot=.&semi=%3B"},
+		{"{&list*}", "&list=red&list=green&list=blue"},
+		// Undefined values
+		{"{undef}", ""},
+		{"{?undef,x}", "?x=1024"},
+		{"{empty_keys}", ""},
+		{"{half}", "50%25"},
+		{"{+half}", "50%25"},
+		{"{count}", "one,two,three"},
+		{"{dub}", "me%2Ftoo"},
+	} {
+		t.Run(tc.template, func(t *testing.T) {
+			tmpl, err := Parse(tc.template)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			got, err := tmpl.Expand(rfcVars)
+			if err != nil {
+				t.Fatalf("failed to expand: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"{",
+		"}",
+		"a}b",
+		"{}",
+		"{=var}",
+		"{var:0}",
+		"{var:abc}",
+		"{va r}",
+		"{var,}",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q): expected an error", s)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		uri      string
+		want     map[string]string
+	}{
+		{"file:///{name}", "file:///readme.md", map[string]string{"name": "readme.md"}},
+		{"file:///{name}", "file:///hello%20world", map[string]string{"name": "hello world"}},
+		{"file:///{+path}", "file:///a/b/c.txt", map[string]string{"path": "a/b/c.txt"}},
+		{"file://{/path*}", "file:///a/b/c.txt", map[string]string{"path": "a/b/c.txt"}},
+		{"users/{id}/posts/{post}", "users/42/posts/7", map[string]string{"id": "42", "post": "7"}},
+		{"map?{x,y}", "map?1024,768", map[string]string{"x": "1024", "y": "768"}},
+		{"{list}", "red,green,blue", map[string]string{"list": "red,green,blue"}},
+		{"X{.x,y}", "X.1024.768", map[string]string{"x": "1024", "y": "768"}},
+		{"{;x,y}", ";x=1024;y=768", map[string]string{"x": "1024", "y": "768"}},
+		{"{;list*}", ";list=red;list=green", map[string]string{"list": "red,green"}},
+		{"search{?q,lang}", "search?lang=en&q=a%20b", map[string]string{"q": "a b", "lang": "en"}},
+		{"search{?q,lang}", "search?q=go", map[string]string{"q": "go"}},
+		{"search{?q,lang}", "search", map[string]string{}},
+		{"search{?q}{&page}", "search?q=go&page=2", map[string]string{"q": "go", "page": "2"}},
+		{"search{?opts*}", "search?a=1&b=2", map[string]string{"a": "1", "b": "2"}},
+		{"{var:3}", "val", map[string]string{"var": "val"}},
+		{"doc{#section}", "doc#intro", map[string]string{"section": "intro"}},
+	} {
+		t.Run(tc.template+" "+tc.uri, func(t *testing.T) {
+			got, ok := MustParse(tc.template).Match(tc.uri)
+			if !ok {
+				t.Fatal("expected a match")
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchRejects(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		uri      string
+	}{
+		{"file:///{name}", "file:///a/b"},
+		{"file:///{name}", "http:///a"},
+		{"users/{id}", "users/1/posts"},
+		{"{var:3}", "value"},
+		{"search{?q}", "search#frag"},
+	} {
+		if _, ok := MustParse(tc.template).Match(tc.uri); ok {
+			t.Errorf("%s matched %s", tc.template, tc.uri)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tmpl := MustParse("db://{table}/{id}{?fields}")
+	vars := map[string]any{"table": "users", "id": "a/b c", "fields": "name"}
+	uri, err := tmpl.Expand(vars)
+	if err != nil {
+		t.Fatalf("failed to expand: %v", err)
+	}
+	got, ok := tmpl.Match(uri)
+	if !ok {
+		t.Fatalf("%s did not match its own expansion %s", tmpl, uri)
+	}
+	want := map[string]string{"table": "users", "id": "a/b c", "fields": "name"}
+	if !maps.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultListChangedDebounce is how long a server waits after a registry
+// changes before it sends list_changed notifications, unless
+// [WithListChangedDebounce] says otherwise.
+const DefaultListChangedDebounce = 50 * time.Millisecond
+
+// WithDisabled registers a tool, prompt or resource disabled, so that no
+// session sees it until it is enabled for everyone or for one session.
+func WithDisabled() RegistrationOption {
+	return registrationOptionFunc(func(r *registration) {
+		r.disabled = true
+	})
+}
+
+// visibility tracks which items of a registry each session can see. Items
+// are keyed by name; per-session settings take precedence over global ones.
+// The registry's mutex guards it.
+type visibility struct {
+	disabled map[string]bool
+	sessions map[*Session]map[string]bool
+}
+
+// itemState is the visibility of one item at a point in time.
+type itemState struct {
+	exists   bool
+	disabled bool
+	sessions map[*Session]bool
+}
+
+func (st itemState) visible(s *Session) bool {
+	if !st.exists {
+		return false
+	}
+	if enabled, ok := st.sessions[s]; ok {
+		return enabled
+	}
+	return !st.disabled
+}
+
+// state captures the visibility of the named item.
+func (v *visibility) state(name string, exists bool) itemState {
+	st := itemState{exists: exists, disabled: v.disabled[name]}
+	for s, items := range v.sessions {
+		if enabled, ok := items[name]; ok {
+			if st.sessions == nil {
+				st.sessions = map[*Session]bool{}
+			}
+			st.sessions[s] = enabled
+		}
+	}
+	return st
+}
+
+// visible reports whether s can see the named item. s is nil outside of a
+// session, which sees only the global settings.
+func (v *visibility) visible(s *Session, name string) bool {
+	if enabled, ok := v.sessions[s][name]; ok {
+		return enabled
+	}
+	return !v.disabled[name]
+}
+
+func (v *visibility) setDisabled(name string, disabled bool) {
+	if v.disabled == nil {
+		v.disabled = map[string]bool{}
+	}
+	if disabled {
+		v.disabled[name] = true
+	} else {
+		delete(v.disabled, name)
+	}
+}
+
+func (v *visibility) setEnabledFor(s *Session, name string, enabled bool) {
+	// The settings of an ended session have been forgotten already and
+	// mustn't come back.
+	if s.hasEnded() {
+		return
+	}
+	if v.sessions == nil {
+		v.sessions = map[*Session]map[string]bool{}
+	}
+	if v.sessions[s] == nil {
+		v.sessions[s] = map[string]bool{}
+	}
+	v.sessions[s][name] = enabled
+}
+
+// remove forgets every setting for the named item.
+func (v *visibility) remove(name string) {
+	delete(v.disabled, name)
+	for s, items := range v.sessions {
+		delete(items, name)
+		if len(items) == 0 {
+			delete(v.sessions, s)
+		}
+	}
+}
+
+// forget drops the settings of a session that has ended.
+func (v *visibility) forget(s *Session) {
+	delete(v.sessions, s)
+}
+
+// changed returns a function reporting whether the list a session sees
+// differs between before and after. An item that exists in both states was
+// redefined if redefined is set, which every session that sees it notices.
+func changed(before, after itemState, redefined bool) func(*Session) bool {
+	return func(s *Session) bool {
+		if redefined {
+			return before.visible(s) || after.visible(s)
+		}
+		return before.visible(s) != after.visible(s)
+	}
+}
+
+// listState holds the visibility settings of a registry and the watchers of
+// its lists.
+type listState struct {
+	visibility visibility
+	watchers   watchers
+}
+
+// update runs fn, which changes the named item, under the registry's lock and
+// tells the watchers which sessions see a different list as a result. exists
+// reports whether the item is registered; fn reports whether it replaced the
+// item's definition.
+func (l *listState) update(mu sync.Locker, name string, exists func() bool, fn func() bool) {
+	mu.Lock()
+	before := l.visibility.state(name, exists())
+	redefined := fn()
+	after := l.visibility.state(name, exists())
+	mu.Unlock()
+	l.watchers.notify(changed(before, after, redefined && before.exists && after.exists))
+}
+
+// forget drops the settings of a session that has ended.
+func (l *listState) forget(mu sync.Locker, s *Session) {
+	mu.Lock()
+	defer mu.Unlock()
+	l.visibility.forget(s)
+}
+
+// listKind names the list a list_changed notification is about.
+type listKind int
+
+const (
+	toolList listKind = 1 << iota
+	promptList
+	resourceList
+)
+
+// watchers are told about changes to a registry. Each watcher gets a
+// function reporting whether a session's list changed.
+type watchers struct {
+	mu   sync.Mutex
+	next int
+	fns  map[int]func(affected func(*Session) bool)
+}
+
+// watch calls fn on every change until the returned function is called.
+func (w *watchers) watch(fn func(affected func(*Session) bool)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fns == nil {
+		w.fns = map[int]func(affected func(*Session) bool){}
+	}
+	id := w.next
+	w.next++
+	w.fns[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.fns, id)
+	}
+}
+
+func (w *watchers) notify(affected func(*Session) bool) {
+	w.mu.Lock()
+	fns := make([]func(affected func(*Session) bool), 0, len(w.fns))
+	for _, fn := range w.fns {
+		fns = append(fns, fn)
+	}
+	w.mu.Unlock()
+	for _, fn := range fns {
+		fn(affected)
+	}
+}
+
+// listNotifier sends the list_changed notifications of a server, coalescing
+// the changes made within the debounce interval into one notification per
+// session and list.
+type listNotifier struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending map[*Session]listKind
+	timer   *time.Timer
+	stopped bool
+}
+
+// changed queues a notification about kind for each session whose list
+// changed.
+func (n *listNotifier) changed(kind listKind, sessions []*Session, affected func(*Session) bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		return
+	}
+	for _, s := range sessions {
+		if !s.hasStarted() || !affected(s) {
+			continue
+		}
+		if n.pending == nil {
+			n.pending = map[*Session]listKind{}
+		}
+		n.pending[s] |= kind
+	}
+	if len(n.pending) > 0 && n.timer == nil {
+		n.timer = time.AfterFunc(n.delay, n.flush)
+	}
+}
+
+func (n *listNotifier) flush() {
+	n.mu.Lock()
+	pending := n.pending
+	n.pending, n.timer = nil, nil
+	n.mu.Unlock()
+
+	ctx := context.Background()
+	for s, kinds := range pending {
+		// Sessions that ended in the meantime can't be reached; there is
+		// nobody to report the error to.
+		if kinds&toolList != 0 {
+			s.ToolsListChanged(ctx)
+		}
+		if kinds&promptList != 0 {
+			s.PromptsListChanged(ctx)
+		}
+		if kinds&resourceList != 0 {
+			s.ResourcesListChanged(ctx)
+		}
+	}
+}
+
+// forget drops pending notifications for a session that has ended.
+func (n *listNotifier) forget(s *Session) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.pending, s)
+}
+
+// stop drops pending notifications and ignores later changes. A server
+// listens only once, so it never needs to start again.
+func (n *listNotifier) stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopped = true
+	n.pending = nil
+	if n.timer != nil {
+		n.timer.Stop()
+		n.timer = nil
+	}
+}